@@ -5,15 +5,27 @@
 package easyapi
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/i18n"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+const (
+	MIME_MERGE_PATCH = "application/merge-patch+json"
+	MIME_JSON_PATCH  = "application/json-patch+json"
 )
 
 var (
@@ -28,12 +40,27 @@ type binderConfig struct {
 	KeepBody bool
 }
 
-// Create a new validation error from a tag and a field
+// Create a new validation error from a tag and a field, the message is in the default locale
 func NewValidationError(tag string, field string, resource interface{}) layer.ValidationError {
-	message := fmt.Sprintf("Field %s failed with condition `%s`", field, tag)
+	return NewLocalizedValidationError(nil, tag, field, "", resource)
+}
+
+// Create a new validation error with a message in the locale of the request, param is the param of the tag (ex: 8 for min=8)
+// The custom messages of the resource can be keys of the i18n catalogs
+func NewLocalizedValidationError(c *gin.Context, tag string, field string, param string, resource interface{}) layer.ValidationError {
+	locale := i18n.GetLocale(c)
+	params := map[string]interface{}{
+		"Field": field,
+		"Tag":   tag,
+		"Param": param,
+	}
+	message, ok := i18n.Translate(locale, i18n.VALIDATION_KEY_PREFIX+tag, params)
+	if !ok {
+		message = i18n.TranslateOr(locale, i18n.VALIDATION_KEY_DEFAULT, params, fmt.Sprintf("Field %s failed with condition `%s`", field, tag))
+	}
 	if m, ok := resource.(layer.ValidationAwareInterface); ok {
 		if customMessage, ok := m.GetCustomValidationMessages()[fmt.Sprintf("%s:%s", field, tag)]; ok {
-			message = customMessage
+			message = i18n.TranslateOr(locale, customMessage, params, customMessage)
 		}
 	}
 
@@ -41,59 +68,368 @@ func NewValidationError(tag string, field string, resource interface{}) layer.Va
 		Tag:     tag,
 		Field:   field,
 		Message: message,
+		Param:   param,
 	}
 }
 
 // Bind and validate recursively a request body to a resource
+// The resource of the context key CONTEXT_KEY_PREVIOUS_RESOURCE is the previous one of an update (PATCH, PUT)
+// The fields the request cannot write keep their previous value if they are omitted
+// The body is validated against the JSON Schema of the resource first if enabled in the resource options
 func BindAndValidate(c *gin.Context, i interface{}) error {
-	// request validation
+	previous, _ := c.Get(CONTEXT_KEY_PREVIOUS_RESOURCE)
+	body, err := readBody(c)
+	if err != nil {
+		return HttpError(c, http.StatusBadRequest, err.Error(), nil)
+	}
+	if validationErrors := validateSchema(c, i, body, isPartialUpdate(c)); len(validationErrors) > 0 {
+		return HttpError(c, http.StatusBadRequest, "Validation errors", validationErrors)
+	}
+	presetDenormalizeFields(c, i, previous)
+	return validate(c, i, previous, bindJSON(c, body, i))
+}
+
+// Decode a json body in a resource like the json binding of gin, and validate it with the request context
+func bindJSON(c *gin.Context, body []byte, i interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if binding.EnableDecoderUseNumber {
+		decoder.UseNumber()
+	}
+	if binding.EnableDecoderDisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(i); err != nil {
+		return err
+	}
+	return validateStruct(c, i)
+}
+
+// Validate a resource with the validator of gin
+// A go-playground validator gets the request as context, the validators registered with a context can use it (ex: to get the DAO of the request)
+// A layer.ValidatorError reported by a validator in the gin context is returned instead of the validation errors
+func validateStruct(c *gin.Context, i interface{}) error {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok && c != nil {
+		n := len(c.Errors)
+		err := v.StructCtx(c, i)
+		for _, e := range c.Errors[n:] {
+			var ve *layer.ValidatorError
+			if errors.As(e.Err, &ve) {
+				return ve
+			}
+		}
+		return err
+	}
+	return binding.Validator.ValidateStruct(i)
+}
+
+// Apply the patch document of a request body to a resource and validate it
+// The content type of the request gives the type of the patch, merge patch (RFC 7396) or json patch (RFC 6902)
+// The previous resource is the one of the context key CONTEXT_KEY_PREVIOUS_RESOURCE, a copy of the resource if not set
+func PatchAndValidate(c *gin.Context, i interface{}) error {
+	previous, ok := c.Get(CONTEXT_KEY_PREVIOUS_RESOURCE)
+	if !ok {
+		previous = utils.DeepCloneInterface(i)
+	}
+	body, err := readBody(c)
+	if err != nil {
+		return HttpError(c, http.StatusBadRequest, err.Error(), nil)
+	}
+	doc, err := json.Marshal(i)
+	if err != nil {
+		return HttpError(c, http.StatusInternalServerError, err.Error(), nil)
+	}
+
+	switch c.ContentType() {
+	case MIME_MERGE_PATCH:
+		doc, err = jsonpatch.MergePatch(doc, body)
+	case MIME_JSON_PATCH:
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.DecodePatch(body)
+		if err == nil {
+			doc, err = patch.Apply(doc)
+		}
+	default:
+		return HttpError(c, http.StatusUnsupportedMediaType, fmt.Sprintf("Content type %s is not a patch", c.ContentType()), nil)
+	}
+	if err != nil {
+		return HttpErrorWithCode(c, http.StatusUnprocessableEntity, layer.ERROR_CODE_INVALID_PATCH, err.Error(), nil)
+	}
+	if validationErrors := validateSchema(c, i, doc, false); len(validationErrors) > 0 {
+		return HttpError(c, http.StatusBadRequest, "Validation errors", validationErrors)
+	}
+
+	// fields removed by the patch are reset
+	resetJSONFields(reflect.ValueOf(i).Elem())
+	err = json.Unmarshal(doc, i)
+	if err == nil {
+		err = validateStruct(c, i)
+	}
+	return validate(c, i, previous, err)
+}
+
+// Validate a resource after its binding, previous is the resource before its update and err is the binding error
+func validate(c *gin.Context, i interface{}, previous interface{}, err error) error {
+	validationErrors, err := getValidationErrors(newValidationContext(c, previous), i, err)
+	if err != nil {
+		return HttpError(c, http.StatusInternalServerError, "Validation error", nil)
+	}
+	if len(validationErrors) > 0 {
+		return HttpError(c, http.StatusBadRequest, "Validation errors", validationErrors)
+	}
+
+	// uuid bindings
+	err = appendBindings(c, i)
+	if err != nil {
+		return HttpError(c, http.StatusNotFound, err.Error(), nil)
+	}
+
+	return nil
+}
+
+// Create the validation context of a request, previous is the resource before its update
+// A replacement of a missing resource is a creation, it uses the validation groups of OPERATION_CREATE
+func newValidationContext(c *gin.Context, previous interface{}) *layer.ValidationContext {
+	token, _ := c.Get(CONTEXT_KEY_TOKEN)
+	return &layer.ValidationContext{
+		Operation: c.GetString(CONTEXT_KEY_OPERATION),
+		Groups:    GetResourceOptions(c).GetValidationGroups(getGroupsOperation(c, previous)),
+		Context:   c,
+		Token:     token,
+		Previous:  previous,
+	}
+}
+
+// Returns the operation giving the groups of a request, a replacement of a missing resource is a creation
+func getGroupsOperation(c *gin.Context, previous interface{}) string {
+	operation := c.GetString(CONTEXT_KEY_OPERATION)
+	if operation == OPERATION_REPLACE && previous == nil {
+		return OPERATION_CREATE
+	}
+	return operation
+}
+
+// Returns the validation errors of a resource after its binding, err is the binding error
+// The denormalization rules are enforced first, the resource is validated again if forbidden fields are restored
+// The error of a validator which could not check a field is returned instead (see layer.ValidatorError)
+func getValidationErrors(vc *layer.ValidationContext, i interface{}, err error) ([]layer.ValidationError, error) {
 	validationErrors := []layer.ValidationError{}
-	var err error
-	if BinderConfig.KeepBody {
-		err = c.ShouldBindBodyWith(i, binding.JSON)
-	} else {
-		err = c.ShouldBindJSON(i)
+	if _, ok := err.(validator.ValidationErrors); ok || err == nil {
+		denormalizeErrors, restored := denormalize(vc.Context, i, vc.Previous)
+		if restored {
+			err = validateStruct(vc.Context, i)
+		}
+		validationErrors = append(validationErrors, denormalizeErrors...)
+	}
+	var verr *layer.ValidatorError
+	if errors.As(err, &verr) {
+		return nil, verr
 	}
 	if err != nil {
 		if ve, ok := err.(validator.ValidationErrors); ok {
 			for _, e := range ve {
-				validationErrors = append(validationErrors, NewValidationError(e.Tag(), e.Field(), i))
+				if !inValidationGroups(i, e.StructNamespace(), vc.Groups) {
+					continue
+				}
+				ve := NewLocalizedValidationError(vc.Context, e.Tag(), e.Field(), e.Param(), i)
+				ve.Path = getValidationPath(i, e.StructNamespace())
+				if parts := strings.SplitN(e.StructNamespace(), ".", 2); len(parts) < 2 || !isSensitivePath(i, parts[1]) {
+					ve.Value = e.Value()
+				}
+				validationErrors = append(validationErrors, ve)
 			}
 		} else {
-			validationErrors = append(validationErrors, NewValidationError("", err.Error(), i))
+			validationErrors = append(validationErrors, NewLocalizedValidationError(vc.Context, "", err.Error(), "", i))
 		}
 	}
 	if iv, ok := i.(layer.ValidationAwareInterface); ok {
-		validationErrors = append(validationErrors, iv.Validate()...)
+		validationErrors = append(validationErrors, completeValidationErrors(i, iv.Validate())...)
 	}
-	if len(validationErrors) > 0 {
-		return HttpError(c, http.StatusBadRequest, "Validation errors", validationErrors)
+	if icv, ok := i.(layer.ContextualValidationAware); ok {
+		validationErrors = append(validationErrors, completeValidationErrors(i, icv.ValidateWithContext(vc))...)
 	}
+	return validationErrors, nil
+}
 
-	// uuid bindings
-	err = AppendBindings(i)
+// Returns the JSON path of a field from its namespace in the struct (ex: Order.Items[3].Qty gives items[3].qty)
+func getValidationPath(i interface{}, namespace string) string {
+	parts := strings.SplitN(namespace, ".", 2)
+	if len(parts) == 2 {
+		if path, _, ok := utils.GetJSONPath(reflect.ValueOf(i), parts[1]); ok {
+			return path
+		}
+	}
+	return parts[len(parts)-1]
+}
+
+// Set the JSON path and the rejected value of the validation errors returned by the resource, the value is not set for the sensitive fields
+// Their field is a path in the resource with the names or the json names of the fields (ex: Items[3].Qty or items[3].qty)
+func completeValidationErrors(i interface{}, validationErrors []layer.ValidationError) []layer.ValidationError {
+	for k, ve := range validationErrors {
+		if ve.Path != "" || ve.Field == "" {
+			continue
+		}
+		path, v, ok := utils.GetJSONPath(reflect.ValueOf(i), ve.Field)
+		if !ok {
+			continue
+		}
+		validationErrors[k].Path = path
+		if ve.Value == nil && v.IsValid() && v.CanInterface() && !isSensitivePath(i, ve.Field) {
+			validationErrors[k].Value = v.Interface()
+		}
+	}
+	return validationErrors
+}
+
+// Returns true if the value of a field must not be sent in the validation errors
+// The sensitive fields have the tag layer.SENSITIVE_TAG or are never serialized (`json:"-"`, `groups:"-"`)
+func isSensitiveField(f reflect.StructField) bool {
+	if _, ok := f.Tag.Lookup(layer.SENSITIVE_TAG); ok {
+		return true
+	}
+	return utils.GetJSONName(f) == "-" || f.Tag.Get(layer.SERIALIZE_GROUPS_TAG) == "-"
+}
+
+// Returns true if a field of a resource or one of its parents is sensitive, false if it is not found
+// The path has the names or the json names of the fields (ex: Items[3].Qty or items[3].qty)
+func isSensitivePath(i interface{}, path string) bool {
+	t := reflect.TypeOf(i)
+	for _, segment := range strings.Split(path, ".") {
+		if k := strings.Index(segment, "["); k >= 0 {
+			segment = segment[:k]
+		}
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		f, ok := lookupStructField(t, segment)
+		if !ok {
+			return false
+		}
+		if isSensitiveField(f) {
+			return true
+		}
+		t = f.Type
+	}
+	return false
+}
+
+// Find a field of a struct type by its json name or its name (case insensitive), the embedded structs are browsed
+func lookupStructField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for k := 0; k < t.NumField(); k++ {
+		f := t.Field(k)
+		jsonName := utils.GetJSONName(f)
+		if f.Anonymous && jsonName == "" && f.Type.Kind() == reflect.Struct {
+			if sf, ok := lookupStructField(f.Type, name); ok {
+				return sf, true
+			}
+		}
+		if (jsonName != "" && jsonName != "-" && jsonName == name) || strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Returns true if the field of a validation error is in one of the groups, the fields without groups are always validated
+// The namespace is the one of the field in the struct (ex: User.Address.Street), all the rules are checked if groups is nil
+func inValidationGroups(i interface{}, namespace string, groups []string) bool {
+	if groups == nil {
+		return true
+	}
+	t := reflect.TypeOf(i)
+	for _, name := range strings.Split(namespace, ".")[1:] {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return true
+		}
+		if k := strings.Index(name, "["); k >= 0 {
+			name = name[:k]
+		}
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return true
+		}
+		if tag, ok := f.Tag.Lookup(layer.VALIDATION_GROUPS_TAG); ok && !containsAny(strings.Split(tag, ","), groups) {
+			return false
+		}
+		t = f.Type
+	}
+	return true
+}
+
+// Returns true if one of the values is in the list
+func containsAny(list []string, values []string) bool {
+	for _, l := range list {
+		for _, v := range values {
+			if strings.TrimSpace(l) == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Read the request body, it is kept in the context key gin.BodyBytesKey if configured
+func readBody(c *gin.Context) ([]byte, error) {
+	if cb, ok := c.Get(gin.BodyBytesKey); ok {
+		if body, ok := cb.([]byte); ok {
+			return body, nil
+		}
+	}
+	body, err := c.GetRawData()
 	if err != nil {
-		return HttpError(c, http.StatusNotFound, err.Error(), nil)
+		return nil, err
+	}
+	if BinderConfig.KeepBody {
+		c.Set(gin.BodyBytesKey, body)
 	}
+	return body, nil
+}
 
-	return nil
+// Reset the fields of a struct which are marshalled in json, the other fields are kept
+func resetJSONFields(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			resetJSONFields(v.Field(i))
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		v.Field(i).Set(reflect.Zero(f.Type))
+	}
 }
 
 // Append bindings based on GetUUIDBindings resource method
 func AppendBindings(item interface{}) error {
+	return appendBindings(nil, item)
+}
+
+// Append bindings with the DAO of the request context
+func appendBindings(c *gin.Context, item interface{}) error {
 	if ib, ok := item.(layer.UUIDBinderInterface); ok {
 		for _, b := range ib.GetUUIDBindings() {
 			if b.UUID == nil {
 				continue
 			}
 
-			_, err := dao.GetResourceDAO(b.BindTo).FindById(b.BindTo, b.UUID.String())
+			_, err := dao.GetContextDAO(c, b.BindTo).FindById(b.BindTo, b.UUID.String())
 			if err != nil {
 				return fmt.Errorf("%s not found", b.Name)
 			}
 			// recursive
 			if bb, ok := b.BindTo.(layer.UUIDBinderInterface); ok {
-				err := AppendBindings(bb)
+				err := appendBindings(c, bb)
 				if err != nil {
 					return err
 				}
@@ -0,0 +1,256 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+// Gin handler for a bulk POST request, the body is an array of resources
+func HandleBulkPost(c *gin.Context, i interface{}) {
+	items, err := bindBulkItems(c)
+	if err != nil {
+		return
+	}
+
+	validationErrors := []layer.ValidationError{}
+	resources := make([]interface{}, len(items))
+	for k, item := range items {
+		ic := utils.CloneInterface(i) // avoid duplicate variable use
+		itemErrors, err := bindBulkItem(c, item, ic, k, nil)
+		if err != nil {
+			HttpError(c, http.StatusInternalServerError, "Validation error", nil)
+			return
+		}
+		validationErrors = append(validationErrors, itemErrors...)
+		resources[k] = ic
+	}
+	if len(validationErrors) > 0 {
+		HttpError(c, http.StatusBadRequest, "Validation errors", validationErrors)
+		return
+	}
+
+	if err := dispatchBulkEvent(c, event.EVENT_RESOURCE_PRE_CREATE, resources, nil); err != nil {
+		return
+	}
+
+	for _, ic := range resources {
+		RemoveUUIDBindings(ic)
+	}
+
+	_, err = dao.GetContextDAO(c, i).CreateMany(resources)
+	if err != nil {
+		HttpErrorFromError(c, err, http.StatusBadRequest, layer.ERROR_CODE_CREATE_FAILED, "Creation error")
+		return
+	}
+
+	if err := dispatchBulkEvent(c, event.EVENT_RESOURCE_POST_CREATE, resources, nil); err != nil {
+		return
+	}
+
+	collectionItems := NewCollectionItem(resources, GetResourceOptions(c).GetSerializeGroups(OPERATION_BULK_CREATE))
+	collectionItems.Count = len(resources)
+	c.JSON(http.StatusCreated, collectionItems)
+}
+
+// Gin handler for a bulk PATCH request, the body is an array of partial resources containing their ID
+func HandleBulkPatch(c *gin.Context, i interface{}) {
+	items, err := bindBulkItems(c)
+	if err != nil {
+		return
+	}
+
+	idKey := getIdentifierJSONName(i)
+	validationErrors := []layer.ValidationError{}
+	previous := make([]interface{}, len(items))
+	resources := make([]interface{}, len(items))
+	for k, item := range items {
+		ic := utils.CloneInterface(i) // avoid duplicate variable use
+		resources[k] = ic
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(item, &fields); err != nil {
+			validationErrors = append(validationErrors, withIndex([]layer.ValidationError{NewLocalizedValidationError(c, "", err.Error(), "", ic)}, k)...)
+			continue
+		}
+		id := strings.Trim(string(fields[idKey]), `"`)
+		if id == "" {
+			validationErrors = append(validationErrors, withIndex([]layer.ValidationError{NewLocalizedValidationError(c, "required", idKey, "", ic)}, k)...)
+			continue
+		}
+		if _, err := dao.GetContextDAO(c, ic).FindById(ic, id); err != nil {
+			validationErrors = append(validationErrors, withIndex([]layer.ValidationError{NewLocalizedValidationError(c, "exists", idKey, "", ic)}, k)...)
+			continue
+		}
+		previous[k] = utils.DeepCloneInterface(ic)
+
+		itemErrors, err := bindBulkItem(c, item, ic, k, previous[k])
+		if err != nil {
+			HttpError(c, http.StatusInternalServerError, "Validation error", nil)
+			return
+		}
+		validationErrors = append(validationErrors, itemErrors...)
+	}
+	if len(validationErrors) > 0 {
+		HttpError(c, http.StatusBadRequest, "Validation errors", validationErrors)
+		return
+	}
+
+	if err := dispatchBulkEvent(c, event.EVENT_RESOURCE_PRE_UPDATE, resources, previous); err != nil {
+		return
+	}
+
+	for _, ic := range resources {
+		RemoveUUIDBindings(ic)
+	}
+
+	_, err = dao.GetContextDAO(c, i).UpdateManyFromPrevious(previous, resources)
+	if err != nil {
+		HttpErrorFromError(c, err, http.StatusBadRequest, layer.ERROR_CODE_UPDATE_FAILED, "Update error")
+		return
+	}
+
+	if err := dispatchBulkEvent(c, event.EVENT_RESOURCE_POST_UPDATE, resources, previous); err != nil {
+		return
+	}
+
+	collectionItems := NewCollectionItem(resources, GetResourceOptions(c).GetSerializeGroups(OPERATION_BULK_UPDATE))
+	collectionItems.Count = len(resources)
+	c.JSON(http.StatusOK, collectionItems)
+}
+
+// Gin handler for a bulk DELETE request, the ids are given in the query param "ids" separated by commas
+func HandleBulkDelete(c *gin.Context, i interface{}) {
+	var ids []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		HttpError(c, http.StatusBadRequest, "Param ids is required", nil)
+		return
+	}
+
+	validationErrors := []layer.ValidationError{}
+	resources := make([]interface{}, len(ids))
+	for k, id := range ids {
+		ic := utils.CloneInterface(i)
+		resources[k] = ic
+		if _, err := dao.GetContextDAO(c, ic).FindById(ic, id); err != nil {
+			validationErrors = append(validationErrors, withIndex([]layer.ValidationError{NewLocalizedValidationError(c, "exists", id, "", ic)}, k)...)
+			continue
+		}
+		if err := appendBindings(c, ic); err != nil {
+			validationErrors = append(validationErrors, withIndex([]layer.ValidationError{NewLocalizedValidationError(c, "", err.Error(), "", ic)}, k)...)
+		}
+	}
+	if len(validationErrors) > 0 {
+		HttpErrorWithCode(c, http.StatusNotFound, layer.ERROR_CODE_NOT_FOUND, "Not found", validationErrors)
+		return
+	}
+
+	if err := dispatchBulkEvent(c, event.EVENT_RESOURCE_PRE_DELETE, resources, nil); err != nil {
+		return
+	}
+
+	// the registered resource is shared by the requests, the DAO may write in the one it gets (ex: a soft delete date)
+	err := dao.GetContextDAO(c, i).DeleteByIds(utils.CloneInterface(i), ids)
+	if err != nil {
+		HttpErrorFromError(c, err, http.StatusBadRequest, layer.ERROR_CODE_DELETE_FAILED, "Delete error")
+		return
+	}
+
+	if err := dispatchBulkEvent(c, event.EVENT_RESOURCE_POST_DELETE, resources, nil); err != nil {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Read the array of items of a bulk request body
+func bindBulkItems(c *gin.Context) ([]json.RawMessage, error) {
+	body, err := readBody(c)
+	if err != nil {
+		return nil, HttpError(c, http.StatusBadRequest, err.Error(), nil)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, HttpError(c, http.StatusBadRequest, fmt.Sprintf("Bulk body must be an array: %s", err.Error()), nil)
+	}
+	return items, nil
+}
+
+// Bind and validate an item of a bulk request, returns the validation errors with the index of the item
+// previous is the resource before its update, nil on creation, the error is the one of a validator which could not check a field
+func bindBulkItem(c *gin.Context, item json.RawMessage, i interface{}, index int, previous interface{}) ([]layer.ValidationError, error) {
+	if validationErrors := validateSchema(c, i, item, isPartialUpdate(c)); len(validationErrors) > 0 {
+		return withIndex(validationErrors, index), nil
+	}
+	err := json.Unmarshal(item, i)
+	if err == nil {
+		err = validateStruct(c, i)
+	}
+	validationErrors, err := getValidationErrors(newValidationContext(c, previous), i, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(validationErrors) == 0 {
+		if err := appendBindings(c, i); err != nil {
+			validationErrors = append(validationErrors, NewLocalizedValidationError(c, "", err.Error(), "", i))
+		}
+	}
+	return withIndex(validationErrors, index), nil
+}
+
+// Returns the json name of the identifier field of a resource, the identifier key of its DAO if it has no such field
+func getIdentifierJSONName(i interface{}) string {
+	key := dao.GetIdentifierKey(i)
+	if f, _, ok := utils.FindStructField(reflect.ValueOf(newResource(i)), key); ok {
+		if name := utils.GetJSONName(f); name != "" {
+			return name
+		}
+		return f.Name
+	}
+	return key
+}
+
+// Dispatch a resource event for each resource of a bulk request, previous is given for updates
+func dispatchBulkEvent(c *gin.Context, eventType string, resources []interface{}, previous []interface{}) error {
+	for k, r := range resources {
+		var changes *event.ChangeSet
+		if previous != nil {
+			changes = event.NewChangeSet(previous[k], r)
+		}
+		err := event.DispatchEvent(c, eventType, &event.ResourceActionEvent{
+			Resource: r,
+			Action:   eventType,
+			Changes:  changes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set the index of a bulk item on its validation errors
+func withIndex(validationErrors []layer.ValidationError, index int) []layer.ValidationError {
+	for k := range validationErrors {
+		idx := index
+		validationErrors[k].Index = &idx
+	}
+	return validationErrors
+}
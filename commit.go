@@ -0,0 +1,59 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
+)
+
+// Functions waiting for the commit of the transaction of a request
+type commitHooks struct {
+	mu    sync.Mutex
+	funcs []func()
+}
+
+// Run a function after the commit of the transaction of a request (ex: to notify a change), it is dropped on rollback
+// It runs immediately if the request has no transaction (see middleware.TransactionMiddleware) or if the context is nil
+func OnCommit(c *gin.Context, fn func()) {
+	if c != nil {
+		if hooks, ok := c.Get(CONTEXT_KEY_COMMIT_HOOKS); ok {
+			h := hooks.(*commitHooks)
+			h.mu.Lock()
+			h.funcs = append(h.funcs, fn)
+			h.mu.Unlock()
+			return
+		}
+	}
+	fn()
+}
+
+// Start to keep the functions given to OnCommit until RunCommitHooks, called when the transaction of a request begins
+func DeferCommitHooks(c *gin.Context) {
+	c.Set(CONTEXT_KEY_COMMIT_HOOKS, &commitHooks{})
+}
+
+// Run the functions given to OnCommit, called after the commit of the transaction of a request
+func RunCommitHooks(c *gin.Context) {
+	hooks, ok := c.Get(CONTEXT_KEY_COMMIT_HOOKS)
+	if !ok {
+		return
+	}
+	h := hooks.(*commitHooks)
+	h.mu.Lock()
+	funcs := h.funcs
+	h.funcs = nil
+	h.mu.Unlock()
+	for _, fn := range funcs {
+		fn()
+	}
+}
+
+// The asynchronous listeners run after the end of the request, their functions given to OnCommit run immediately
+func init() {
+	event.RegisterRequestScopedKeys(CONTEXT_KEY_COMMIT_HOOKS)
+}
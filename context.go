@@ -5,5 +5,14 @@
 package easyapi
 
 const (
-	CONTEXT_KEY_TOKEN = "ctx.auth.token"
+	CONTEXT_KEY_TOKEN            = "ctx.auth.token"
+	CONTEXT_KEY_RESOURCE_OPTIONS = "ctx.resource.options"
+	CONTEXT_KEY_ROUTE_NAME       = "ctx.route.name"
+	CONTEXT_KEY_OPERATION        = "ctx.route.operation"
+	// Resource before its update, set by HandlePut and HandlePatch for the validation
+	CONTEXT_KEY_PREVIOUS_RESOURCE = "ctx.resource.previous"
+	// Denormalization groups added to the ones of the operation, set with AddDenormalizeGroups (ex: the roles of the user)
+	CONTEXT_KEY_DENORMALIZE_GROUPS = "ctx.denormalize.groups"
+	// Functions to run after the commit of the transaction of the request, see OnCommit
+	CONTEXT_KEY_COMMIT_HOOKS = "ctx.commit.hooks"
 )
@@ -7,6 +7,8 @@ package easyapi
 import (
 	"fmt"
 	"net/http"
+	"reflect"
+	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -33,9 +35,9 @@ func HandlePost(c *gin.Context, i interface{}) {
 
 	RemoveUUIDBindings(ic)
 
-	_, err = dao.GetResourceDAO(ic).Create(ic)
+	_, err = dao.GetContextDAO(c, ic).Create(ic)
 	if err != nil {
-		HttpError(c, http.StatusBadRequest, "Creation error", nil)
+		HttpErrorFromError(c, err, http.StatusBadRequest, layer.ERROR_CODE_CREATE_FAILED, "Creation error")
 		return
 	}
 
@@ -47,21 +49,26 @@ func HandlePost(c *gin.Context, i interface{}) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, NewItem(ic, &layer.SerializeGroups{
-		Values: []string{SERIALIZER_CONTEXT_KEY_ONE},
-	}))
+	c.JSON(http.StatusCreated, NewItem(ic, GetResourceOptions(c).GetSerializeGroups(OPERATION_CREATE)))
 }
 
 // Gin handler for a GET request
+// The query params fields and expand select the serialized fields and the loaded relations, all the bindings are loaded without expand
 func HandleGet(c *gin.Context, i interface{}, id string) {
 	ic := utils.CloneInterface(i) // avoid duplicate variable use
-	_, err := dao.GetResourceDAO(ic).FindById(ic, id)
+	s, err := getSelection(c, ic)
 	if err != nil {
-		HttpError(c, http.StatusNotFound, "Not found", nil)
+		return
+	}
+	_, err = getSelectionDAO(c, ic, s).FindById(ic, id)
+	if err != nil {
+		HttpErrorFromError(c, err, http.StatusNotFound, layer.ERROR_CODE_NOT_FOUND, "Not found")
 		return
 	}
 
-	if err := AppendBindings(ic); err != nil {
+	if len(s.Expand) > 0 {
+		expandBindings(c, ic, s)
+	} else if err := appendBindings(c, ic); err != nil {
 		return
 	}
 
@@ -73,14 +80,19 @@ func HandleGet(c *gin.Context, i interface{}, id string) {
 		return
 	}
 
-	c.JSON(http.StatusOK, NewItem(ic, &layer.SerializeGroups{
-		Values: []string{SERIALIZER_CONTEXT_KEY_ONE},
-	}))
+	sc := GetResourceOptions(c).GetSerializeGroups(OPERATION_READ)
+	sc.Fields = s.Fields
+	c.JSON(http.StatusOK, NewItem(ic, sc))
 }
 
 // Gin handler for a LIST request
+// The query params fields and expand select the serialized fields and the loaded relations, they are not filters
 func HandleList(c *gin.Context, i interface{}) {
 	ic := utils.CloneInterface(i) // avoid duplicate variable use
+	s, err := getSelection(c, ic)
+	if err != nil {
+		return
+	}
 
 	// Pagination
 	var pf *dao.PaginationFilter
@@ -96,12 +108,12 @@ func HandleList(c *gin.Context, i interface{}) {
 	var ff []dao.FilterFunc
 	if iqfa, ok := ic.(layer.QueryFilterAware); ok {
 		for key, val := range c.Request.URL.Query() {
-			if key == pQueryName {
+			if key == pQueryName || key == QUERY_PARAM_FIELDS || key == QUERY_PARAM_EXPAND {
 				continue
 			}
 			qf := iqfa.GetQueryFilterSet().GetByParam(key)
 			if qf == nil {
-				HttpError(c, http.StatusNotFound, fmt.Sprintf("Param %s is not a filter", key), nil)
+				HttpErrorWithCode(c, http.StatusNotFound, layer.ERROR_CODE_INVALID_FILTER, fmt.Sprintf("Param %s is not a filter", key), nil)
 				return
 			}
 			ff = append(ff, qf.Func(key, val[0], qf.Args))
@@ -115,14 +127,15 @@ func HandleList(c *gin.Context, i interface{}) {
 		}
 	}
 
-	r, err := dao.GetResourceDAO(ic).FindByFilter(ic, ff, pf)
+	r, err := getSelectionDAO(c, ic, s).FindByFilter(ic, ff, pf)
 	if err != nil {
-		HttpError(c, http.StatusNotFound, "Get collection request error", nil)
+		HttpErrorFromError(c, err, http.StatusNotFound, layer.ERROR_CODE_LIST_FAILED, "Get collection request error")
 		return
 	}
 
 	all := r.All()
 	for _, l := range all {
+		expandBindings(c, l, s)
 		err = event.DispatchEvent(c, event.EVENT_RESOURCE_POST_READ, &event.ResourceActionEvent{
 			Resource: l,
 			Action:   event.EVENT_RESOURCE_POST_READ,
@@ -132,9 +145,9 @@ func HandleList(c *gin.Context, i interface{}) {
 		}
 	}
 
-	collectionItems := NewCollectionItem(all, &layer.SerializeGroups{
-		Values: []string{SERIALIZER_CONTEXT_KEY_LIST},
-	})
+	sc := GetResourceOptions(c).GetSerializeGroups(OPERATION_LIST)
+	sc.Fields = s.Fields
+	collectionItems := NewCollectionItem(all, sc)
 	collectionItems.Count = len(all)
 	collectionItems.Total = r.CountTotal()
 	collectionItems.Links = pc.GetLinksFromContext(c, collectionItems.Total)
@@ -142,22 +155,32 @@ func HandleList(c *gin.Context, i interface{}) {
 }
 
 // Gin handler for a PATCH request
+// The body is a merge patch or a json patch document if the content type of the request is one of them
 func HandlePatch(c *gin.Context, i interface{}, id string) {
 	ic := utils.CloneInterface(i) // avoid duplicate variable use
-	_, err := dao.GetResourceDAO(ic).FindById(ic, id)
-	clone := utils.CloneInterface(ic)
+	_, err := dao.GetContextDAO(c, ic).FindById(ic, id)
+	clone := utils.DeepCloneInterface(ic)
 	if err != nil {
-		HttpError(c, http.StatusNotFound, "Not found", nil)
+		HttpErrorFromError(c, err, http.StatusNotFound, layer.ERROR_CODE_NOT_FOUND, "Not found")
 		return
 	}
-
-	if err := BindAndValidate(c, ic); err != nil {
+	// the denormalization and the validators compare the body with the stored resource
+	c.Set(CONTEXT_KEY_PREVIOUS_RESOURCE, clone)
+
+	switch c.ContentType() {
+	case MIME_MERGE_PATCH, MIME_JSON_PATCH:
+		err = PatchAndValidate(c, ic)
+	default:
+		err = BindAndValidate(c, ic)
+	}
+	if err != nil {
 		return
 	}
 
 	err = event.DispatchEvent(c, event.EVENT_RESOURCE_PRE_UPDATE, &event.ResourceActionEvent{
 		Resource: ic,
 		Action:   event.EVENT_RESOURCE_PRE_UPDATE,
+		Changes:  event.NewChangeSet(clone, ic),
 	})
 	if err != nil {
 		return
@@ -165,33 +188,106 @@ func HandlePatch(c *gin.Context, i interface{}, id string) {
 
 	RemoveUUIDBindings(ic)
 
-	_, err = dao.GetResourceDAO(ic).UpdateFromPrevious(clone, ic)
+	_, err = dao.GetContextDAO(c, ic).UpdateFromPrevious(clone, ic)
 	if err != nil {
-		HttpError(c, http.StatusBadRequest, "Update error", nil)
+		HttpErrorFromError(c, err, http.StatusBadRequest, layer.ERROR_CODE_UPDATE_FAILED, "Update error")
 		return
 	}
 
 	err = event.DispatchEvent(c, event.EVENT_RESOURCE_POST_UPDATE, &event.ResourceActionEvent{
 		Resource: ic,
 		Action:   event.EVENT_RESOURCE_POST_UPDATE,
+		Changes:  event.NewChangeSet(clone, ic),
+	})
+	if err != nil {
+		return
+	}
+
+	if GetResourceOptions(c).UpdateNoContent {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, NewItem(ic, GetResourceOptions(c).GetSerializeGroups(OPERATION_UPDATE)))
+}
+
+// Gin handler for a PUT request, the resource is fully replaced by the request body
+func HandlePut(c *gin.Context, i interface{}, id string) {
+	previous := utils.CloneInterface(i) // avoid duplicate variable use
+	_, err := dao.GetContextDAO(c, previous).FindById(previous, id)
+	if err != nil && !layer.IsNotFoundError(err) {
+		HttpErrorFromError(c, err, http.StatusInternalServerError, layer.ERROR_CODE_INTERNAL, "Get error")
+		return
+	}
+	exists := err == nil
+	if !exists && !GetResourceOptions(c).Upsert {
+		HttpErrorFromError(c, err, http.StatusNotFound, layer.ERROR_CODE_NOT_FOUND, "Not found")
+		return
+	}
+
+	ic := utils.CloneInterface(i) // missing fields in the body are reset to their default value
+	if exists {
+		c.Set(CONTEXT_KEY_PREVIOUS_RESOURCE, previous)
+		// the identifier is kept for the validators excluding the current resource (ex: unique)
+		idKey := dao.GetIdentifierKey(ic)
+		if from, ok := utils.FindField(reflect.ValueOf(previous), idKey); ok {
+			if to, ok := utils.FindField(reflect.ValueOf(ic), idKey); ok && to.CanSet() {
+				to.Set(from)
+			}
+		}
+	}
+	if err := BindAndValidate(c, ic); err != nil {
+		return
+	}
+
+	preEvent, postEvent := event.EVENT_RESOURCE_PRE_UPDATE, event.EVENT_RESOURCE_POST_UPDATE
+	if !exists {
+		preEvent, postEvent = event.EVENT_RESOURCE_PRE_CREATE, event.EVENT_RESOURCE_POST_CREATE
+	}
+
+	err = event.DispatchEvent(c, preEvent, &event.ResourceActionEvent{
+		Resource: ic,
+		Action:   preEvent,
+		Changes:  newChangeSet(exists, previous, ic),
+	})
+	if err != nil {
+		return
+	}
+
+	RemoveUUIDBindings(ic)
+
+	_, err = dao.GetContextDAO(c, ic).Replace(ic, id, !exists)
+	if err != nil {
+		HttpErrorFromError(c, err, http.StatusBadRequest, layer.ERROR_CODE_UPDATE_FAILED, "Update error")
+		return
+	}
+
+	err = event.DispatchEvent(c, postEvent, &event.ResourceActionEvent{
+		Resource: ic,
+		Action:   postEvent,
+		Changes:  newChangeSet(exists, previous, ic),
 	})
 	if err != nil {
 		return
 	}
 
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	c.JSON(status, NewItem(ic, GetResourceOptions(c).GetSerializeGroups(OPERATION_REPLACE)))
 }
 
 // Gin handler for a DELETE request
 func HandleDelete(c *gin.Context, i interface{}, id string) {
 	ic := utils.CloneInterface(i)
 
-	_, err := dao.GetResourceDAO(ic).FindById(ic, id)
+	_, err := dao.GetContextDAO(c, ic).FindById(ic, id)
 	if err != nil {
-		HttpError(c, http.StatusNotFound, "Not found", nil)
+		HttpErrorFromError(c, err, http.StatusNotFound, layer.ERROR_CODE_NOT_FOUND, "Not found")
 		return
 	}
 
-	if err := AppendBindings(ic); err != nil {
+	if err := appendBindings(c, ic); err != nil {
 		return
 	}
 
@@ -203,41 +299,117 @@ func HandleDelete(c *gin.Context, i interface{}, id string) {
 		return
 	}
 
-	err = dao.GetResourceDAO(ic).DeleteById(ic, id)
+	err = dao.GetContextDAO(c, ic).DeleteById(ic, id)
 	if err != nil {
-		HttpError(c, http.StatusBadRequest, "Delete error", nil)
+		HttpErrorFromError(c, err, http.StatusBadRequest, layer.ERROR_CODE_DELETE_FAILED, "Delete error")
 		return
 	}
-}
 
-// Shortcut to handle multiple crud requests
-func CRUDL(r gin.IRoutes, path string, i interface{}, methods string) {
-	if methods == "" {
-		methods = "CRUDL"
+	err = event.DispatchEvent(c, event.EVENT_RESOURCE_POST_DELETE, &event.ResourceActionEvent{
+		Resource: ic,
+		Action:   event.EVENT_RESOURCE_POST_DELETE,
+	})
+	if err != nil {
+		return
 	}
-	if strings.Contains(methods, "C") {
-		r.POST(path, func(c *gin.Context) {
-			HandlePost(c, i)
-		})
+
+	c.Status(http.StatusNoContent)
+}
+
+// Returns the change set of an update, nil if the resource is created
+func newChangeSet(isUpdate bool, from interface{}, to interface{}) *event.ChangeSet {
+	if !isUpdate {
+		return nil
 	}
-	if strings.Contains(methods, "R") {
-		r.GET(path+"/:id", func(c *gin.Context) {
-			HandleGet(c, i, c.Param("id"))
-		})
+	return event.NewChangeSet(from, to)
+}
+
+// Shortcut to handle multiple crud requests, methods is a string of CRUDL letters (ex: "CRUL")
+func CRUDL(r gin.IRoutes, path string, i interface{}, methods string) {
+	CRUDLWithOptions(r, path, i, NewResourceOptions(methods))
+}
+
+// Register the crud routes of a resource configured by its options
+func CRUDLWithOptions(r gin.IRoutes, path string, i interface{}, opts ResourceOptions) []ResourceRoute {
+	if opts.Name == "" {
+		opts.Name = strings.ReplaceAll(strings.Trim(path, "/"), "/", ".")
 	}
-	if strings.Contains(methods, "U") {
-		r.PATCH(path+"/:id", func(c *gin.Context) {
-			HandlePatch(c, i, c.Param("id"))
-		})
+	idPath := path + "/:" + opts.GetIDParam()
+
+	var routes []ResourceRoute
+	register := func(operation string, method string, routePath string, handler gin.HandlerFunc) {
+		if !opts.HasOperation(operation) {
+			return
+		}
+		route := ResourceRoute{
+			Name:      opts.GetRouteName(operation),
+			Method:    method,
+			Path:      routePath,
+			Operation: operation,
+		}
+		handlers := []gin.HandlerFunc{resourceContextHandler(&opts, route)}
+		if routePath == idPath && opts.IDPattern != "" {
+			handlers = append(handlers, idPatternHandler(opts.GetIDParam(), regexp.MustCompile(opts.IDPattern)))
+		}
+		handlers = append(handlers, opts.Middlewares[operation]...)
+		handlers = append(handlers, handler)
+		r.Handle(method, routePath, handlers...)
+		routes = append(routes, route)
 	}
-	if strings.Contains(methods, "D") {
-		r.DELETE(path+"/:id", func(c *gin.Context) {
-			HandleDelete(c, i, c.Param("id"))
-		})
+
+	register(OPERATION_CREATE, http.MethodPost, path, func(c *gin.Context) {
+		HandlePost(c, i)
+	})
+	register(OPERATION_READ, http.MethodGet, idPath, func(c *gin.Context) {
+		HandleGet(c, i, c.Param(opts.GetIDParam()))
+	})
+	register(OPERATION_UPDATE, http.MethodPatch, idPath, func(c *gin.Context) {
+		HandlePatch(c, i, c.Param(opts.GetIDParam()))
+	})
+	register(OPERATION_REPLACE, http.MethodPut, idPath, func(c *gin.Context) {
+		HandlePut(c, i, c.Param(opts.GetIDParam()))
+	})
+	register(OPERATION_DELETE, http.MethodDelete, idPath, func(c *gin.Context) {
+		HandleDelete(c, i, c.Param(opts.GetIDParam()))
+	})
+	register(OPERATION_LIST, http.MethodGet, path, func(c *gin.Context) {
+		HandleList(c, i)
+	})
+	register(OPERATION_BULK_CREATE, http.MethodPost, path+"/_bulk", func(c *gin.Context) {
+		HandleBulkPost(c, i)
+	})
+	register(OPERATION_BULK_UPDATE, http.MethodPatch, path+"/_bulk", func(c *gin.Context) {
+		HandleBulkPatch(c, i)
+	})
+	register(OPERATION_BULK_DELETE, http.MethodDelete, path, func(c *gin.Context) {
+		HandleBulkDelete(c, i)
+	})
+	register(OPERATION_STREAM, http.MethodGet, path+"/_stream", func(c *gin.Context) {
+		HandleStream(c, i)
+	})
+	register(OPERATION_SCHEMA, http.MethodGet, path+"/_schema", func(c *gin.Context) {
+		HandleSchema(c, i)
+	})
+
+	registerResource(r, path, i, opts, routes)
+	return routes
+}
+
+// Gin handler to store the resource options and the route information in the context
+func resourceContextHandler(opts *ResourceOptions, route ResourceRoute) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(CONTEXT_KEY_RESOURCE_OPTIONS, opts)
+		c.Set(CONTEXT_KEY_ROUTE_NAME, route.Name)
+		c.Set(CONTEXT_KEY_OPERATION, route.Operation)
 	}
-	if strings.Contains(methods, "L") {
-		r.GET(path, func(c *gin.Context) {
-			HandleList(c, i)
-		})
+}
+
+// Gin handler to check the ID param matches a pattern
+func idPatternHandler(param string, pattern *regexp.Regexp) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !pattern.MatchString(c.Param(param)) {
+			HttpError(c, http.StatusNotFound, "Not found", nil)
+			c.Abort()
+		}
 	}
 }
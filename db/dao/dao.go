@@ -4,7 +4,15 @@
 
 package dao
 
-import "gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+import (
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+const (
+	// Identifier key of the resources if the DAO does not give it
+	DEFAULT_IDENTIFIER_KEY = "id"
+)
 
 // Default DAO of application, it is used when a resource has no custom DAO configured
 var defaultDAO DAOInterface
@@ -19,10 +27,18 @@ type DAOInterface interface {
 	FindById(dest interface{}, id string) (DAOResultInterface, error)
 	// UpdateFromPrevious is the function to update a resource from a previous resource
 	UpdateFromPrevious(from interface{}, to interface{}) (DAOResultInterface, error)
+	// Replace is the function to replace all the fields of the resource identified by id, it is created if upsert is true and it does not exist
+	Replace(resource interface{}, id string, upsert bool) (DAOResultInterface, error)
 	// Create is the function to create a resource
 	Create(resource interface{}) (DAOResultInterface, error)
 	// DeleteById is the function to delete a resource by its id
 	DeleteById(resource interface{}, id string) error
+	// CreateMany is the function to create multiple resources at once
+	CreateMany(resources []interface{}) (DAOResultsInterface, error)
+	// UpdateManyFromPrevious is the function to update multiple resources from their previous resources, from and to have the same order
+	UpdateManyFromPrevious(from []interface{}, to []interface{}) (DAOResultsInterface, error)
+	// DeleteByIds is the function to delete multiple resources by their ids
+	DeleteByIds(resource interface{}, ids []string) error
 }
 
 // Interface of a single results
@@ -47,11 +63,49 @@ type GetDAOInterface interface {
 	GetDAO() DAOInterface
 }
 
+// Interface to implement in a DAO which depends on the request (ex: to use the transaction of the request)
+type ContextAwareDAOInterface interface {
+	WithContext(c *gin.Context) DAOInterface
+}
+
+// Interface to implement in a DAO to give the column (or key) of a struct field in the database, the field name is used otherwise
+type ColumnNameAwareDAOInterface interface {
+	GetColumnName(resource interface{}, field string) string
+}
+
+// Interface to implement in a DAO to give the json name (or name) of the identifier field of the resources, "id" is used otherwise
+type IdentifierAwareDAOInterface interface {
+	GetIdentifierKey() string
+}
+
+// Interface to implement in a DAO which can find the resources whose columns are nil or zero values
+// The params are exact matches like the ones of FindBy, the zero columns match the NULL and the zero values
+type ZeroFilterAwareDAOInterface interface {
+	FindByZero(dest interface{}, params map[string]string, zero []string, pf *PaginationFilter) (DAOResultsInterface, error)
+}
+
+// Interface to implement in a DAO which can load some fields and preload relations of the resources it finds
+type QueryOptionsAwareDAOInterface interface {
+	WithQueryOptions(options *QueryOptions) DAOInterface
+}
+
+// Fields and relations to load with the resources, all the fields and the default relations if empty
+// Fields are struct field names, Preload are relation paths with the names of the UUID bindings (ex: Bank.Owner)
+type QueryOptions struct {
+	Fields  []string
+	Preload []string
+}
+
 // Init the default DAO of application
 func InitDefaultDAO(dao DAOInterface) {
 	defaultDAO = dao
 }
 
+// Get the default DAO of application, nil if not initialized
+func GetDefaultDAO() DAOInterface {
+	return defaultDAO
+}
+
 // Get the DAO of a resource, or the default one if no one is configured
 func GetResourceDAO(resource interface{}) DAOInterface {
 	if rdo, ok := resource.(GetDAOInterface); ok {
@@ -63,6 +117,23 @@ func GetResourceDAO(resource interface{}) DAOInterface {
 	return defaultDAO
 }
 
+// Get the json name (or name) of the identifier field of a resource from its DAO
+func GetIdentifierKey(resource interface{}) string {
+	if id, ok := GetResourceDAO(resource).(IdentifierAwareDAOInterface); ok && id.GetIdentifierKey() != "" {
+		return id.GetIdentifierKey()
+	}
+	return DEFAULT_IDENTIFIER_KEY
+}
+
+// Get the DAO of a resource for a request, the context is ignored if nil or if the DAO is not aware of it
+func GetContextDAO(c *gin.Context, resource interface{}) DAOInterface {
+	d := GetResourceDAO(resource)
+	if cd, ok := d.(ContextAwareDAOInterface); ok && c != nil {
+		return cd.WithContext(c)
+	}
+	return d
+}
+
 // Type function to create to handle filters, it starts from a Statement and returns the same updated Statement
 type FilterFunc func(s *utils.Context) *utils.Context
 
@@ -0,0 +1,41 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package dao
+
+import "fmt"
+
+const (
+	// A unique key is duplicated
+	CONSTRAINT_UNIQUE = "unique"
+	// A foreign key references a missing resource
+	CONSTRAINT_FOREIGN_KEY = "foreign_key"
+	// The resource is still referenced by a foreign key of another resource
+	CONSTRAINT_REFERENCED = "referenced"
+	// A required column is null
+	CONSTRAINT_NOT_NULL = "not_null"
+)
+
+// Error of a database constraint violation returned by the DAOs
+// Field is the json name of the field of the resource, or the column if the field is unknown, it may be empty
+type ConstraintError struct {
+	Type       string
+	Constraint string
+	Column     string
+	Field      string
+	Err        error
+}
+
+// Implements the Error interface
+func (e *ConstraintError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s constraint violation", e.Type)
+	}
+	return fmt.Sprintf("%s constraint violation on %s", e.Type, e.Field)
+}
+
+// Returns the error of the database driver
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
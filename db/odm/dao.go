@@ -5,6 +5,7 @@
 package odm
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 
@@ -16,6 +17,8 @@ import (
 
 var (
 	DAO *nosqlDAO
+
+	documentBaseType = reflect.TypeOf(bongo.DocumentBase{})
 )
 
 type nosqlDAO struct {
@@ -87,6 +90,24 @@ func (n *nosqlDAO) FindByFilter(dest interface{}, ff []dao.FilterFunc, pf *dao.P
 	}, nil
 }
 
+func (n *nosqlDAO) GetColumnName(resource interface{}, field string) string {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if f, ok := t.FieldByName(field); ok {
+		if name := strings.Split(f.Tag.Get("bson"), ",")[0]; name != "" {
+			return name
+		}
+	}
+	return strings.ToLower(field)
+}
+
+// Implements dao.IdentifierAwareDAOInterface
+func (n *nosqlDAO) GetIdentifierKey() string {
+	return n.IdentifierKey
+}
+
 func (n *nosqlDAO) FindBy(dest interface{}, params map[string]string, pf *dao.PaginationFilter) (dao.DAOResultsInterface, error) {
 	var ff []dao.FilterFunc
 	for k, p := range params {
@@ -95,6 +116,40 @@ func (n *nosqlDAO) FindBy(dest interface{}, params map[string]string, pf *dao.Pa
 	return n.FindByFilter(dest, ff, pf)
 }
 
+// Implements dao.ZeroFilterAwareDAOInterface
+func (n *nosqlDAO) FindByZero(dest interface{}, params map[string]string, zero []string, pf *dao.PaginationFilter) (dao.DAOResultsInterface, error) {
+	var ff []dao.FilterFunc
+	for k, p := range params {
+		ff = append(ff, ApplyExactFilter(k, p, nil))
+	}
+	for _, key := range zero {
+		ff = append(ff, applyZeroFilter(key, n.getZeroValue(dest, key)))
+	}
+	return n.FindByFilter(dest, ff, pf)
+}
+
+// Returns the zero value of the type of the field stored with a key, nil if there is none
+func (n *nosqlDAO) getZeroValue(resource interface{}, key string) interface{} {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for k := 0; k < t.NumField(); k++ {
+		if n.GetColumnName(resource, t.Field(k).Name) != key {
+			continue
+		}
+		ft := t.Field(k).Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		return reflect.Zero(ft).Interface()
+	}
+	return nil
+}
+
 func (n *nosqlDAO) FindById(dest interface{}, id string) (dao.DAOResultInterface, error) {
 	err := DB.Collection(getCollectionName(dest)).FindById(bson.ObjectIdHex(id), dest)
 	if err != nil {
@@ -109,7 +164,7 @@ func (n *nosqlDAO) FindById(dest interface{}, id string) (dao.DAOResultInterface
 func (n *nosqlDAO) UpdateFromPrevious(from interface{}, to interface{}) (dao.DAOResultInterface, error) {
 	err := DB.Collection(getCollectionName(to)).Save(to.(bongo.Document))
 	if err != nil {
-		return nil, err
+		return nil, translateError(to, err)
 	}
 
 	return &daoResult{
@@ -117,10 +172,37 @@ func (n *nosqlDAO) UpdateFromPrevious(from interface{}, to interface{}) (dao.DAO
 	}, nil
 }
 
+func (n *nosqlDAO) Replace(resource interface{}, id string, upsert bool) (dao.DAOResultInterface, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, fmt.Errorf("invalid id %s", id)
+	}
+	collection := DB.Collection(getCollectionName(resource))
+	if !upsert {
+		previous := utils.CloneInterface(resource)
+		err := collection.FindById(bson.ObjectIdHex(id), previous)
+		if err != nil {
+			return nil, err
+		}
+		// the creation date is kept, the document is saved as an existing one
+		copyDocumentBase(previous, resource)
+	}
+
+	doc := resource.(bongo.Document)
+	doc.SetId(bson.ObjectIdHex(id))
+	err := collection.Save(doc)
+	if err != nil {
+		return nil, translateError(resource, err)
+	}
+
+	return &daoResult{
+		r: resource,
+	}, nil
+}
+
 func (n *nosqlDAO) Create(resource interface{}) (dao.DAOResultInterface, error) {
 	err := DB.Collection(getCollectionName(resource)).Save(resource.(bongo.Document))
 	if err != nil {
-		return nil, err
+		return nil, translateError(resource, err)
 	}
 
 	return &daoResult{
@@ -136,6 +218,69 @@ func (n *nosqlDAO) DeleteById(resource interface{}, id string) error {
 	return nil
 }
 
+func (n *nosqlDAO) CreateMany(resources []interface{}) (dao.DAOResultsInterface, error) {
+	for _, r := range resources {
+		_, err := n.Create(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &daoResults{
+		r:          resources,
+		totalCount: len(resources),
+	}, nil
+}
+
+func (n *nosqlDAO) UpdateManyFromPrevious(from []interface{}, to []interface{}) (dao.DAOResultsInterface, error) {
+	for k := range to {
+		_, err := n.UpdateFromPrevious(from[k], to[k])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &daoResults{
+		r:          to,
+		totalCount: len(to),
+	}, nil
+}
+
+func (n *nosqlDAO) DeleteByIds(resource interface{}, ids []string) error {
+	for _, id := range ids {
+		r := utils.CloneInterface(resource)
+		_, err := n.FindById(r, id)
+		if err != nil {
+			return err
+		}
+		err = n.DeleteById(r, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Copy the tracking fields of the embedded bongo.DocumentBase of a document (creation date, modification date, existence) to another one
+func copyDocumentBase(from interface{}, to interface{}) {
+	fv, tv := getDocumentBase(from), getDocumentBase(to)
+	if fv.IsValid() && tv.IsValid() && tv.CanSet() {
+		tv.Set(fv)
+	}
+}
+
+// Returns the embedded bongo.DocumentBase of a document, an invalid value if there is none
+func getDocumentBase(doc interface{}) reflect.Value {
+	v := reflect.Indirect(reflect.ValueOf(doc))
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	for k := 0; k < v.NumField(); k++ {
+		if f := v.Type().Field(k); f.Anonymous && f.Type == documentBaseType {
+			return v.Field(k)
+		}
+	}
+	return reflect.Value{}
+}
+
 func getCollectionName(resource interface{}) string {
 	split := strings.Split(reflect.TypeOf(resource).String(), ".")
 	collection := split[len(split)-1] + "s"
@@ -151,6 +296,15 @@ func ApplyExactFilter(param string, value string, args interface{}) dao.FilterFu
 	}
 }
 
+// Query filter of the null, missing or zero values of a key
+func applyZeroFilter(key string, zero interface{}) dao.FilterFunc {
+	return func(s *utils.Context) *utils.Context {
+		filters := s.Get("s").(*statement).Filters
+		filters[key] = bson.M{"$in": []interface{}{nil, zero}}
+		return s
+	}
+}
+
 func init() {
 	DAO = NewNosqlDAO("id")
 }
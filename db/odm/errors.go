@@ -0,0 +1,92 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package odm
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-bongo/bongo"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/schema"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	// ex: E11000 duplicate key error collection: db.users index: email_1 dup key: { email: "a@b.c" }
+	mongoIndexRegexp  = regexp.MustCompile(`index: (?:\S*\$)?(\S+)`)
+	mongoDupKeyRegexp = regexp.MustCompile(`dup key: \{ ([^:\s]+):`)
+	mongoIndexKeySep  = regexp.MustCompile(`_-?1(?:_|$)`)
+)
+
+// Register the mappings of the mgo and bongo errors
+func init() {
+	layer.RegisterErrorMapping(layer.ErrorMapping{
+		Match: func(err error) bool {
+			switch err.(type) {
+			case bongo.DocumentNotFoundError, *bongo.DocumentNotFoundError:
+				return true
+			}
+			return errors.Is(err, mgo.ErrNotFound)
+		},
+		Status:  http.StatusNotFound,
+		Code:    layer.ERROR_CODE_NOT_FOUND,
+		Message: "Not found",
+	})
+}
+
+// Translate the duplicate key errors into a dao.ConstraintError, the other errors are returned as is
+func translateError(resource interface{}, err error) error {
+	if !mgo.IsDup(err) {
+		return err
+	}
+	ce := &dao.ConstraintError{
+		Type: dao.CONSTRAINT_UNIQUE,
+		Err:  err,
+	}
+	msg := err.Error()
+	if m := mongoIndexRegexp.FindStringSubmatch(msg); m != nil {
+		ce.Constraint = m[1]
+		ce.Column = mongoIndexKeySep.Split(m[1], 2)[0]
+	}
+	if m := mongoDupKeyRegexp.FindStringSubmatch(msg); m != nil {
+		ce.Column = m[1]
+	}
+	if ce.Column != "" {
+		ce.Field = getFieldName(resource, ce.Column)
+	}
+	return ce
+}
+
+// Returns the json name of the field of a resource stored in a bson key, the key if not found
+func getFieldName(resource interface{}, key string) string {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return key
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		bsonName := strings.Split(f.Tag.Get("bson"), ",")[0]
+		if bsonName == "" {
+			bsonName = strings.ToLower(f.Name)
+		}
+		if bsonName != key {
+			continue
+		}
+		name, _ := schema.JSONName(f)
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	}
+	return key
+}
@@ -5,28 +5,28 @@
 package orm
 
 import (
+	"fmt"
+	"reflect"
 	"strings"
 
+	"github.com/gin-gonic/gin"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
 	DAO *relationalDAO
-	UOW *unitOfWork
 )
 
 // relationalDAO implements DAOInterface and allow to query on relational databases
 type relationalDAO struct {
 	IdentifierKey string
-}
-
-// Unit of work, the working resource
-type unitOfWork struct {
-	From interface{}
-	To   interface{}
+	db            *gorm.DB
+	options       *dao.QueryOptions
 }
 
 func NewRelationalDAO(identifierKey string) *relationalDAO {
@@ -35,8 +35,34 @@ func NewRelationalDAO(identifierKey string) *relationalDAO {
 	}
 }
 
+// Returns a copy of the DAO using the database of the request
+func (rdao *relationalDAO) WithContext(c *gin.Context) dao.DAOInterface {
+	return &relationalDAO{
+		IdentifierKey: rdao.IdentifierKey,
+		db:            GetDB(c),
+		options:       rdao.options,
+	}
+}
+
+// Returns a copy of the DAO selecting the fields and preloading the relations of the options in its finds
+func (rdao *relationalDAO) WithQueryOptions(options *dao.QueryOptions) dao.DAOInterface {
+	return &relationalDAO{
+		IdentifierKey: rdao.IdentifierKey,
+		db:            rdao.db,
+		options:       options,
+	}
+}
+
+// Returns the database used by the DAO, the global one by default
+func (rdao *relationalDAO) getDB() *gorm.DB {
+	if rdao.db != nil {
+		return rdao.db
+	}
+	return DB
+}
+
 func (rdao *relationalDAO) FindByFilter(dest interface{}, ff []dao.FilterFunc, pf *dao.PaginationFilter) (dao.DAOResultsInterface, error) {
-	st := DB.Model(dest)
+	st := rdao.getDB().Model(dest)
 	stCtx := utils.NewContext().With("c", st)
 	for _, f := range ff {
 		stCtx = f(stCtx)
@@ -51,6 +77,20 @@ func (rdao *relationalDAO) FindByFilter(dest interface{}, ff []dao.FilterFunc, p
 		st = st.Limit(pf.Limit).Offset(pf.Offset)
 	}
 
+	st = rdao.applyQueryOptions(st, dest)
+
+	// Preloaded relations are loaded by Find
+	if rdao.options != nil && len(rdao.options.Preload) > 0 {
+		list := reflect.New(reflect.SliceOf(reflect.TypeOf(dest)))
+		if r := st.Find(list.Interface()); r.Error != nil {
+			return nil, r.Error
+		}
+		for k := 0; k < list.Elem().Len(); k++ {
+			ret.r = append(ret.r, list.Elem().Index(k).Interface())
+		}
+		return ret, nil
+	}
+
 	// Joins with linked entities
 	if stb, ok := dest.(layer.UUIDBinderInterface); ok {
 		for _, b := range stb.GetUUIDBindings() {
@@ -65,7 +105,7 @@ func (rdao *relationalDAO) FindByFilter(dest interface{}, ff []dao.FilterFunc, p
 	defer r.Close()
 	var list []interface{}
 	for r.Next() {
-		DB.ScanRows(r, dest)
+		rdao.getDB().ScanRows(r, dest)
 		list = append(list, utils.CloneInterface(dest))
 	}
 
@@ -73,6 +113,22 @@ func (rdao *relationalDAO) FindByFilter(dest interface{}, ff []dao.FilterFunc, p
 	return ret, nil
 }
 
+// Implements dao.IdentifierAwareDAOInterface
+func (rdao *relationalDAO) GetIdentifierKey() string {
+	return rdao.IdentifierKey
+}
+
+func (rdao *relationalDAO) GetColumnName(resource interface{}, field string) string {
+	stmt := &gorm.Statement{DB: rdao.getDB()}
+	if err := stmt.Parse(resource); err != nil {
+		return field
+	}
+	if f := stmt.Schema.LookUpField(field); f != nil && f.DBName != "" {
+		return f.DBName
+	}
+	return field
+}
+
 func (rdao *relationalDAO) FindBy(dest interface{}, params map[string]string, pf *dao.PaginationFilter) (dao.DAOResultsInterface, error) {
 	var ff []dao.FilterFunc
 	for k, p := range params {
@@ -81,8 +137,37 @@ func (rdao *relationalDAO) FindBy(dest interface{}, params map[string]string, pf
 	return rdao.FindByFilter(dest, ff, pf)
 }
 
+// Implements dao.ZeroFilterAwareDAOInterface
+func (rdao *relationalDAO) FindByZero(dest interface{}, params map[string]string, zero []string, pf *dao.PaginationFilter) (dao.DAOResultsInterface, error) {
+	var ff []dao.FilterFunc
+	for k, p := range params {
+		ff = append(ff, ApplyExactFilter(k, p, nil))
+	}
+	for _, column := range zero {
+		ff = append(ff, applyZeroFilter(column, rdao.getZeroValue(dest, column)))
+	}
+	return rdao.FindByFilter(dest, ff, pf)
+}
+
+// Returns the zero value of the type of a column, nil if the column is unknown
+func (rdao *relationalDAO) getZeroValue(resource interface{}, column string) interface{} {
+	stmt := &gorm.Statement{DB: rdao.getDB()}
+	if err := stmt.Parse(resource); err != nil {
+		return nil
+	}
+	f := stmt.Schema.LookUpField(column)
+	if f == nil {
+		return nil
+	}
+	t := f.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.Zero(t).Interface()
+}
+
 func (rdao *relationalDAO) FindById(dest interface{}, id string) (dao.DAOResultInterface, error) {
-	r := DB.First(dest, rdao.IdentifierKey+" = ?", id)
+	r := rdao.applyQueryOptions(rdao.getDB(), dest).First(dest, rdao.IdentifierKey+" = ?", id)
 	if r.Error != nil {
 		return nil, r.Error
 	}
@@ -93,13 +178,9 @@ func (rdao *relationalDAO) FindById(dest interface{}, id string) (dao.DAOResultI
 }
 
 func (rdao *relationalDAO) UpdateFromPrevious(from interface{}, to interface{}) (dao.DAOResultInterface, error) {
-	UOW = &unitOfWork{
-		From: from,
-		To:   to,
-	}
-	r := DB.Model(from).Updates(to)
+	r := rdao.getDB().Model(from).Updates(to)
 	if r.Error != nil {
-		return nil, r.Error
+		return nil, rdao.translateError(to, r.Error, false)
 	}
 	ret := &relationalDAOResult{
 		r: to,
@@ -107,10 +188,51 @@ func (rdao *relationalDAO) UpdateFromPrevious(from interface{}, to interface{})
 	return ret, nil
 }
 
+func (rdao *relationalDAO) Replace(resource interface{}, id string, upsert bool) (dao.DAOResultInterface, error) {
+	stmt := &gorm.Statement{DB: rdao.getDB()}
+	if err := stmt.Parse(resource); err != nil {
+		return nil, err
+	}
+	field := stmt.Schema.LookUpField(rdao.IdentifierKey)
+	if field == nil {
+		return nil, fmt.Errorf("identifier %s not found in %s", rdao.IdentifierKey, stmt.Schema.Name)
+	}
+	if err := field.Set(stmt.Context, reflect.ValueOf(resource), id); err != nil {
+		return nil, err
+	}
+
+	if upsert {
+		var count int64
+		r := rdao.getDB().Model(resource).Where(rdao.IdentifierKey+" = ?", id).Count(&count)
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		if count == 0 {
+			return rdao.Create(resource)
+		}
+	}
+
+	// creation dates are kept, all other fields are updated even with zero values
+	var omit []string
+	for _, f := range stmt.Schema.Fields {
+		if f.AutoCreateTime > 0 {
+			omit = append(omit, f.DBName)
+		}
+	}
+	r := rdao.getDB().Model(resource).Select("*").Omit(omit...).Where(rdao.IdentifierKey+" = ?", id).Updates(resource)
+	if r.Error != nil {
+		return nil, rdao.translateError(resource, r.Error, false)
+	}
+	ret := &relationalDAOResult{
+		r: resource,
+	}
+	return ret, nil
+}
+
 func (rdao *relationalDAO) Create(resource interface{}) (dao.DAOResultInterface, error) {
-	r := DB.Create(resource)
+	r := rdao.getDB().Create(resource)
 	if r.Error != nil {
-		return nil, r.Error
+		return nil, rdao.translateError(resource, r.Error, false)
 	}
 	ret := &relationalDAOResult{
 		r: resource,
@@ -119,13 +241,115 @@ func (rdao *relationalDAO) Create(resource interface{}) (dao.DAOResultInterface,
 }
 
 func (rdao *relationalDAO) DeleteById(resource interface{}, id string) error {
-	r := DB.Where(rdao.IdentifierKey+" = ?", id).Delete(resource)
+	r := rdao.getDB().Where(rdao.IdentifierKey+" = ?", id).Delete(resource)
+	if r.Error != nil {
+		return rdao.translateError(resource, r.Error, true)
+	}
+	return nil
+}
+
+func (rdao *relationalDAO) CreateMany(resources []interface{}) (dao.DAOResultsInterface, error) {
+	ret := &relationalDAOResults{
+		r:          resources,
+		totalCount: int64(len(resources)),
+	}
+	if len(resources) == 0 {
+		return ret, nil
+	}
+
+	// typed slice of pointers to insert all resources in batches
+	list := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(resources[0])), 0, len(resources))
+	for _, r := range resources {
+		list = reflect.Append(list, reflect.ValueOf(r))
+	}
+	r := rdao.getDB().CreateInBatches(list.Interface(), 100)
+	if r.Error != nil {
+		return nil, rdao.translateError(resources[0], r.Error, false)
+	}
+	return ret, nil
+}
+
+func (rdao *relationalDAO) UpdateManyFromPrevious(from []interface{}, to []interface{}) (dao.DAOResultsInterface, error) {
+	err := rdao.getDB().Transaction(func(tx *gorm.DB) error {
+		for k := range to {
+			r := tx.Model(from[k]).Updates(to[k])
+			if r.Error != nil {
+				return rdao.translateError(to[k], r.Error, false)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &relationalDAOResults{
+		r:          to,
+		totalCount: int64(len(to)),
+	}, nil
+}
+
+func (rdao *relationalDAO) DeleteByIds(resource interface{}, ids []string) error {
+	r := rdao.getDB().Where(rdao.IdentifierKey+" IN ?", ids).Delete(resource)
 	if r.Error != nil {
-		return r.Error
+		return rdao.translateError(resource, r.Error, true)
 	}
 	return nil
 }
 
+// Select the fields and preload the relations of the options of the DAO
+// The identifier and the foreign keys of the relations are always selected
+func (rdao *relationalDAO) applyQueryOptions(st *gorm.DB, dest interface{}) *gorm.DB {
+	if rdao.options == nil {
+		return st
+	}
+	for _, p := range rdao.options.Preload {
+		st = st.Preload(p)
+	}
+	if len(rdao.options.Fields) == 0 {
+		return st
+	}
+
+	stmt := &gorm.Statement{DB: rdao.getDB()}
+	if err := stmt.Parse(dest); err != nil {
+		return st
+	}
+	columns := map[string]bool{}
+	if f := stmt.Schema.LookUpField(rdao.IdentifierKey); f != nil {
+		columns[f.DBName] = true
+	}
+	for _, name := range rdao.options.Fields {
+		if f := stmt.Schema.LookUpField(name); f != nil && f.DBName != "" {
+			columns[f.DBName] = true
+		}
+	}
+	// foreign keys of the bindings
+	for _, rel := range stmt.Schema.Relationships.BelongsTo {
+		for _, ref := range rel.References {
+			columns[ref.ForeignKey.DBName] = true
+		}
+	}
+	for _, p := range rdao.options.Preload {
+		rel, ok := stmt.Schema.Relationships.Relations[strings.Split(p, ".")[0]]
+		if !ok {
+			continue
+		}
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				columns[ref.PrimaryKey.DBName] = true
+			} else if ref.ForeignKey.Schema == stmt.Schema {
+				columns[ref.ForeignKey.DBName] = true
+			}
+		}
+	}
+	selects := make([]string, 0, len(columns))
+	for _, f := range stmt.Schema.Fields {
+		if columns[f.DBName] {
+			selects = append(selects, stmt.Schema.Table+"."+f.DBName)
+		}
+	}
+	return st.Select(selects)
+}
+
 type relationalDAOResult struct {
 	r dao.S
 }
@@ -155,6 +379,19 @@ func ApplyExactFilter(param string, value string, args interface{}) dao.FilterFu
 	}
 }
 
+// Query filter of the NULL or zero values of a column, only the NULL values if zero is nil
+func applyZeroFilter(column string, zero interface{}) dao.FilterFunc {
+	return func(s *utils.Context) *utils.Context {
+		isNull := clause.Eq{Column: clause.Column{Name: column}, Value: nil}
+		if zero == nil {
+			s.Get("c").(*gorm.DB).Where(isNull)
+			return s
+		}
+		s.Get("c").(*gorm.DB).Where(clause.Or(isNull, clause.Eq{Column: clause.Column{Name: column}, Value: zero}))
+		return s
+	}
+}
+
 // Query filter of type LIKE MATCH
 func ApplyLikeFilter(param string, value string, args interface{}) dao.FilterFunc {
 	return func(s *utils.Context) *utils.Context {
@@ -185,4 +422,6 @@ func ApplyOrderFilter(param string, value string, args interface{}) dao.FilterFu
 
 func init() {
 	DAO = NewRelationalDAO("id")
+	// the transaction of a request is closed when the asynchronous listeners run
+	event.RegisterRequestScopedKeys(CONTEXT_KEY_TX)
 }
@@ -0,0 +1,193 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	jsonschema "gitlab.com/kjose/jgmc/api/internal/easyapi/schema"
+	"gorm.io/gorm"
+)
+
+var (
+	// mysql (github.com/go-sql-driver/mysql)
+	mysqlNumberRegexp     = regexp.MustCompile(`^Error (\d+)`)
+	mysqlDuplicateRegexp  = regexp.MustCompile(`Duplicate entry '.*' for key '([^']+)'`)
+	mysqlForeignKeyRegexp = regexp.MustCompile("CONSTRAINT `([^`]+)` FOREIGN KEY \\(`([^`]+)`\\)")
+	mysqlColumnRegexp     = regexp.MustCompile(`(?:Column|Field) '([^']+)'`)
+	// postgres (github.com/jackc/pgx and github.com/lib/pq)
+	postgresKeyRegexp    = regexp.MustCompile(`Key \(([^),]+)`)
+	postgresColumnRegexp = regexp.MustCompile(`column "([^"]+)"`)
+	// sqlite
+	sqliteConstraintRegexp = regexp.MustCompile(`^(UNIQUE|NOT NULL|FOREIGN KEY) constraint failed(?:: ([^\s,]+))?`)
+)
+
+// Register the mappings of the gorm errors
+func init() {
+	layer.RegisterErrorMapping(layer.ErrorMapping{
+		Match: func(err error) bool {
+			return errors.Is(err, gorm.ErrRecordNotFound)
+		},
+		Status:  http.StatusNotFound,
+		Code:    layer.ERROR_CODE_NOT_FOUND,
+		Message: "Not found",
+	})
+}
+
+// Translate the constraint violations of the database into a dao.ConstraintError, the other errors are returned as is
+// When deleting, the foreign key violations mean the resource is still referenced
+func (rdao *relationalDAO) translateError(resource interface{}, err error, deleting bool) error {
+	ce := parseConstraintError(err)
+	if ce == nil {
+		return err
+	}
+	if deleting && ce.Type == dao.CONSTRAINT_FOREIGN_KEY {
+		ce.Type = dao.CONSTRAINT_REFERENCED
+	}
+	if ce.Type == dao.CONSTRAINT_REFERENCED {
+		// the column belongs to the referencing table
+		ce.Column = ""
+	}
+	if ce.Column != "" {
+		ce.Field = rdao.getFieldName(resource, ce.Column)
+	}
+	return ce
+}
+
+// Parse the constraint violation errors of the mysql, postgres and sqlite drivers, nil if err is not one
+func parseConstraintError(err error) *dao.ConstraintError {
+	ce := &dao.ConstraintError{Err: err}
+	msg := err.Error()
+
+	var sqlState interface{ SQLState() string }
+	if errors.As(err, &sqlState) {
+		constraint := getStringField(sqlState, "ConstraintName", "Constraint")
+		column := getStringField(sqlState, "ColumnName", "Column")
+		detail := getStringField(sqlState, "Detail")
+		if m := postgresKeyRegexp.FindStringSubmatch(detail); m != nil {
+			column = m[1]
+		}
+		switch sqlState.SQLState() {
+		case "23505":
+			ce.Type = dao.CONSTRAINT_UNIQUE
+		case "23503":
+			ce.Type = dao.CONSTRAINT_FOREIGN_KEY
+			if strings.Contains(detail, "is still referenced") {
+				ce.Type = dao.CONSTRAINT_REFERENCED
+			}
+		case "23502":
+			ce.Type = dao.CONSTRAINT_NOT_NULL
+			if m := postgresColumnRegexp.FindStringSubmatch(msg); column == "" && m != nil {
+				column = m[1]
+			}
+		default:
+			return nil
+		}
+		if column == "" {
+			column = constraint
+		}
+		ce.Constraint, ce.Column = constraint, column
+		return ce
+	}
+
+	if m := mysqlNumberRegexp.FindStringSubmatch(msg); m != nil {
+		switch m[1] {
+		case "1062":
+			ce.Type = dao.CONSTRAINT_UNIQUE
+			if m := mysqlDuplicateRegexp.FindStringSubmatch(msg); m != nil {
+				ce.Constraint = m[1]
+				ce.Column = m[1][strings.LastIndex(m[1], ".")+1:]
+			}
+		case "1452", "1451":
+			ce.Type = dao.CONSTRAINT_FOREIGN_KEY
+			if m[1] == "1451" {
+				ce.Type = dao.CONSTRAINT_REFERENCED
+			}
+			if m := mysqlForeignKeyRegexp.FindStringSubmatch(msg); m != nil {
+				ce.Constraint, ce.Column = m[1], m[2]
+			}
+		case "1048", "1364":
+			ce.Type = dao.CONSTRAINT_NOT_NULL
+			if m := mysqlColumnRegexp.FindStringSubmatch(msg); m != nil {
+				ce.Column = m[1]
+			}
+		default:
+			return nil
+		}
+		return ce
+	}
+
+	if m := sqliteConstraintRegexp.FindStringSubmatch(msg); m != nil {
+		switch m[1] {
+		case "UNIQUE":
+			ce.Type = dao.CONSTRAINT_UNIQUE
+		case "NOT NULL":
+			ce.Type = dao.CONSTRAINT_NOT_NULL
+		case "FOREIGN KEY":
+			ce.Type = dao.CONSTRAINT_FOREIGN_KEY
+		}
+		ce.Column = m[2][strings.LastIndex(m[2], ".")+1:]
+		return ce
+	}
+
+	// errors translated by gorm (config TranslateError), the column is unknown
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		ce.Type = dao.CONSTRAINT_UNIQUE
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		ce.Type = dao.CONSTRAINT_FOREIGN_KEY
+	default:
+		return nil
+	}
+	return ce
+}
+
+// Returns the json name of the field of a resource mapped to a column or to an index (ex: idx_users_email), the column if not found
+func (rdao *relationalDAO) getFieldName(resource interface{}, column string) string {
+	stmt := &gorm.Statement{DB: rdao.getDB()}
+	if err := stmt.Parse(resource); err != nil {
+		return column
+	}
+	index := strings.TrimSuffix(strings.TrimSuffix(column, "_key"), "_fkey")
+	var found string
+	var name string
+	for _, f := range stmt.Schema.Fields {
+		if f.DBName == "" || (f.DBName != column && !strings.HasSuffix(index, "_"+f.DBName)) {
+			continue
+		}
+		// the longest column wins (ex: idx_users_bank_id is bank_id rather than id)
+		if len(f.DBName) > len(found) {
+			found = f.DBName
+			name, _ = jsonschema.JSONName(f.StructField)
+			if name == "" || name == "-" {
+				name = f.Name
+			}
+		}
+	}
+	if found == "" {
+		return column
+	}
+	return name
+}
+
+// Returns the first string field found in a driver error (ex: ColumnName of pgconn.PgError), empty if there is none
+func getStringField(err interface{}, names ...string) string {
+	v := reflect.Indirect(reflect.ValueOf(err))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, name := range names {
+		if f := v.FieldByName(name); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+			return f.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,328 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// Error with the fields of pgconn.PgError (github.com/jackc/pgx)
+type pgError struct {
+	Code           string
+	Message        string
+	Detail         string
+	ColumnName     string
+	ConstraintName string
+}
+
+func (e *pgError) Error() string {
+	return fmt.Sprintf("ERROR: %s (SQLSTATE %s)", e.Message, e.Code)
+}
+
+func (e *pgError) SQLState() string {
+	return e.Code
+}
+
+// Error with the fields of pq.Error (github.com/lib/pq)
+type pqError struct {
+	Code       string
+	Message    string
+	Detail     string
+	Column     string
+	Constraint string
+}
+
+func (e *pqError) Error() string {
+	return "pq: " + e.Message
+}
+
+func (e *pqError) SQLState() string {
+	return e.Code
+}
+
+type testUser struct {
+	ID     uint   `json:"id"`
+	Email  string `json:"email"`
+	BankID uint   `json:"bankId"`
+	Name   string
+	Secret string `json:"-"`
+}
+
+func TestParseConstraintError(t *testing.T) {
+	cases := []struct {
+		name       string
+		err        error
+		isNil      bool
+		typ        string
+		constraint string
+		column     string
+	}{
+		{
+			name:       "mysql 8 unique index",
+			err:        errors.New("Error 1062 (23000): Duplicate entry 'john@doe.com' for key 'users.idx_users_email'"),
+			typ:        dao.CONSTRAINT_UNIQUE,
+			constraint: "users.idx_users_email",
+			column:     "idx_users_email",
+		},
+		{
+			name:       "mysql 5 unique index",
+			err:        errors.New("Error 1062: Duplicate entry 'john@doe.com' for key 'idx_users_email'"),
+			typ:        dao.CONSTRAINT_UNIQUE,
+			constraint: "idx_users_email",
+			column:     "idx_users_email",
+		},
+		{
+			name:       "mysql composite unique index",
+			err:        errors.New("Error 1062 (23000): Duplicate entry 'john@doe.com-1' for key 'users.idx_users_email_bank_id'"),
+			typ:        dao.CONSTRAINT_UNIQUE,
+			constraint: "users.idx_users_email_bank_id",
+			column:     "idx_users_email_bank_id",
+		},
+		{
+			name:       "mysql foreign key",
+			err:        errors.New("Error 1452 (23000): Cannot add or update a child row: a foreign key constraint fails (`app`.`users`, CONSTRAINT `fk_users_bank` FOREIGN KEY (`bank_id`) REFERENCES `banks` (`id`))"),
+			typ:        dao.CONSTRAINT_FOREIGN_KEY,
+			constraint: "fk_users_bank",
+			column:     "bank_id",
+		},
+		{
+			name:       "mysql referenced",
+			err:        errors.New("Error 1451 (23000): Cannot delete or update a parent row: a foreign key constraint fails (`app`.`users`, CONSTRAINT `fk_users_bank` FOREIGN KEY (`bank_id`) REFERENCES `banks` (`id`))"),
+			typ:        dao.CONSTRAINT_REFERENCED,
+			constraint: "fk_users_bank",
+			column:     "bank_id",
+		},
+		{
+			name:   "mysql null column",
+			err:    errors.New("Error 1048 (23000): Column 'email' cannot be null"),
+			typ:    dao.CONSTRAINT_NOT_NULL,
+			column: "email",
+		},
+		{
+			name:   "mysql missing default value",
+			err:    errors.New("Error 1364 (HY000): Field 'email' doesn't have a default value"),
+			typ:    dao.CONSTRAINT_NOT_NULL,
+			column: "email",
+		},
+		{
+			name:  "mysql other error",
+			err:   errors.New("Error 1045 (28000): Access denied for user 'app'@'localhost' (using password: YES)"),
+			isNil: true,
+		},
+		{
+			name:   "sqlite unique",
+			err:    errors.New("UNIQUE constraint failed: users.email"),
+			typ:    dao.CONSTRAINT_UNIQUE,
+			column: "email",
+		},
+		{
+			name:   "sqlite composite unique",
+			err:    errors.New("UNIQUE constraint failed: users.email, users.bank_id"),
+			typ:    dao.CONSTRAINT_UNIQUE,
+			column: "email",
+		},
+		{
+			name:   "sqlite not null",
+			err:    errors.New("NOT NULL constraint failed: users.email"),
+			typ:    dao.CONSTRAINT_NOT_NULL,
+			column: "email",
+		},
+		{
+			name: "sqlite foreign key",
+			err:  errors.New("FOREIGN KEY constraint failed"),
+			typ:  dao.CONSTRAINT_FOREIGN_KEY,
+		},
+		{
+			name: "pgx unique",
+			err: &pgError{
+				Code:           "23505",
+				Message:        `duplicate key value violates unique constraint "idx_users_email"`,
+				Detail:         "Key (email)=(john@doe.com) already exists.",
+				ConstraintName: "idx_users_email",
+			},
+			typ:        dao.CONSTRAINT_UNIQUE,
+			constraint: "idx_users_email",
+			column:     "email",
+		},
+		{
+			name: "pgx composite unique",
+			err: &pgError{
+				Code:           "23505",
+				Message:        `duplicate key value violates unique constraint "idx_users_email_bank_id"`,
+				Detail:         "Key (email, bank_id)=(john@doe.com, 1) already exists.",
+				ConstraintName: "idx_users_email_bank_id",
+			},
+			typ:        dao.CONSTRAINT_UNIQUE,
+			constraint: "idx_users_email_bank_id",
+			column:     "email",
+		},
+		{
+			name: "pgx foreign key",
+			err: &pgError{
+				Code:           "23503",
+				Message:        `insert or update on table "users" violates foreign key constraint "fk_users_bank"`,
+				Detail:         `Key (bank_id)=(42) is not present in table "banks".`,
+				ConstraintName: "fk_users_bank",
+			},
+			typ:        dao.CONSTRAINT_FOREIGN_KEY,
+			constraint: "fk_users_bank",
+			column:     "bank_id",
+		},
+		{
+			name: "pgx referenced",
+			err: &pgError{
+				Code:           "23503",
+				Message:        `update or delete on table "banks" violates foreign key constraint "fk_users_bank" on table "users"`,
+				Detail:         `Key (id)=(1) is still referenced from table "users".`,
+				ConstraintName: "fk_users_bank",
+			},
+			typ:        dao.CONSTRAINT_REFERENCED,
+			constraint: "fk_users_bank",
+			column:     "id",
+		},
+		{
+			name: "pgx not null",
+			err: &pgError{
+				Code:       "23502",
+				Message:    `null value in column "email" of relation "users" violates not-null constraint`,
+				ColumnName: "email",
+			},
+			typ:    dao.CONSTRAINT_NOT_NULL,
+			column: "email",
+		},
+		{
+			name: "pq unique without detail",
+			err: &pqError{
+				Code:       "23505",
+				Message:    `duplicate key value violates unique constraint "users_email_key"`,
+				Constraint: "users_email_key",
+			},
+			typ:        dao.CONSTRAINT_UNIQUE,
+			constraint: "users_email_key",
+			column:     "users_email_key",
+		},
+		{
+			name: "pq not null from the message",
+			err: &pqError{
+				Code:    "23502",
+				Message: `null value in column "email" violates not-null constraint`,
+			},
+			typ:    dao.CONSTRAINT_NOT_NULL,
+			column: "email",
+		},
+		{
+			name:  "postgres other error",
+			err:   &pgError{Code: "42P01", Message: `relation "users" does not exist`},
+			isNil: true,
+		},
+		{
+			name: "gorm translated duplicated key",
+			err:  fmt.Errorf("create user: %w", gorm.ErrDuplicatedKey),
+			typ:  dao.CONSTRAINT_UNIQUE,
+		},
+		{
+			name: "gorm translated foreign key",
+			err:  gorm.ErrForeignKeyViolated,
+			typ:  dao.CONSTRAINT_FOREIGN_KEY,
+		},
+		{
+			name:  "not a constraint error",
+			err:   gorm.ErrRecordNotFound,
+			isNil: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ce := parseConstraintError(tt.err)
+			if tt.isNil {
+				if ce != nil {
+					t.Fatalf("expected no constraint error, got %+v", ce)
+				}
+				return
+			}
+			if ce == nil {
+				t.Fatal("expected a constraint error, got nil")
+			}
+			if ce.Type != tt.typ || ce.Constraint != tt.constraint || ce.Column != tt.column {
+				t.Errorf("got (%s, %s, %s), expected (%s, %s, %s)", ce.Type, ce.Constraint, ce.Column, tt.typ, tt.constraint, tt.column)
+			}
+			if ce.Err != tt.err {
+				t.Errorf("the driver error is not kept")
+			}
+		})
+	}
+}
+
+func TestGetFieldName(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdao := &relationalDAO{db: db}
+	cases := []struct {
+		column string
+		field  string
+	}{
+		{"email", "email"},
+		{"idx_users_email", "email"},
+		{"users_email_key", "email"},
+		// the longest column wins
+		{"bank_id", "bankId"},
+		{"idx_users_bank_id", "bankId"},
+		{"users_bank_id_fkey", "bankId"},
+		{"id", "id"},
+		// composite index, its last column
+		{"idx_users_email_bank_id", "bankId"},
+		// field name without json name
+		{"name", "Name"},
+		{"secret", "Secret"},
+		{"idx_users_unknown", "idx_users_unknown"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.column, func(t *testing.T) {
+			if field := rdao.getFieldName(&testUser{}, tt.column); field != tt.field {
+				t.Errorf("got %s, expected %s", field, tt.field)
+			}
+		})
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdao := &relationalDAO{db: db}
+	cases := []struct {
+		name     string
+		err      error
+		deleting bool
+		typ      string
+		field    string
+	}{
+		{"mysql 8 unique index", errors.New("Error 1062 (23000): Duplicate entry 'john@doe.com' for key 'users.idx_users_email'"), false, dao.CONSTRAINT_UNIQUE, "email"},
+		{"sqlite unique", errors.New("UNIQUE constraint failed: users.email"), false, dao.CONSTRAINT_UNIQUE, "email"},
+		{"pgx foreign key", &pgError{Code: "23503", Detail: `Key (bank_id)=(42) is not present in table "banks".`, ConstraintName: "fk_users_bank"}, false, dao.CONSTRAINT_FOREIGN_KEY, "bankId"},
+		// the column of a referenced resource belongs to the referencing table
+		{"sqlite foreign key when deleting", errors.New("FOREIGN KEY constraint failed"), true, dao.CONSTRAINT_REFERENCED, ""},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var ce *dao.ConstraintError
+			if !errors.As(rdao.translateError(&testUser{}, tt.err, tt.deleting), &ce) {
+				t.Fatal("expected a constraint error")
+			}
+			if ce.Type != tt.typ || ce.Field != tt.field {
+				t.Errorf("got (%s, %s), expected (%s, %s)", ce.Type, ce.Field, tt.typ, tt.field)
+			}
+		})
+	}
+}
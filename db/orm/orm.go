@@ -10,11 +10,16 @@ import (
 	"log"
 	"os"
 
+	"github.com/gin-gonic/gin"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+const (
+	CONTEXT_KEY_TX = "ctx.orm.tx"
+)
+
 var DB *gorm.DB
 
 // Init the orm DAO
@@ -48,3 +53,13 @@ func Init(driver gorm.Dialector, isDefault bool, loggerConfig *logger.Config) er
 	}
 	return nil
 }
+
+// Get the database of a request, it is the transaction of the request if one is opened
+func GetDB(c *gin.Context) *gorm.DB {
+	if c != nil {
+		if tx, ok := c.Get(CONTEXT_KEY_TX); ok {
+			return tx.(*gorm.DB)
+		}
+	}
+	return DB
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+)
+
+// Message of the outbox, written in the same transaction as the resource change
+type OutboxMessage struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	EventType    string     `gorm:"size:64;index" json:"eventType"`
+	ResourceType string     `gorm:"size:128" json:"resourceType"`
+	Payload      string     `gorm:"type:text" json:"payload"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `gorm:"type:text" json:"lastError,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	DeliveredAt  *time.Time `gorm:"index" json:"deliveredAt,omitempty"`
+}
+
+// Outbox configuration
+type OutboxConfig struct {
+	// Resource events written in the outbox, the POST_* resource events by default
+	EventTypes []string
+	// Returns the payload of a resource, the resource serialized with the "one" group by default
+	Serialize func(resource interface{}) interface{}
+}
+
+// Relay of the outbox messages to a publisher
+type OutboxRelay struct {
+	Publisher Publisher
+	// Delay between two polls of the outbox
+	Interval time.Duration
+	// Max number of messages relayed by poll
+	BatchSize int
+	// Max number of attempts of a message
+	MaxAttempts int
+	// Called with the errors of the polls, they are logged if not set
+	OnError func(err error)
+}
+
+// Table of the outbox messages
+func (OutboxMessage) TableName() string {
+	return "easyapi_outbox"
+}
+
+// Implements json.Marshaler, the payload is kept as raw json
+func (m OutboxMessage) MarshalJSON() ([]byte, error) {
+	type message OutboxMessage
+	return json.Marshal(&struct {
+		message
+		Payload json.RawMessage `json:"payload"`
+	}{
+		message: message(m),
+		Payload: json.RawMessage(m.Payload),
+	})
+}
+
+// Create the outbox table
+func MigrateOutbox() error {
+	return DB.AutoMigrate(&OutboxMessage{})
+}
+
+// Register the listeners writing the resource events in the outbox
+// The messages are written with the transaction of the request, see middleware.TransactionMiddleware
+func RegisterOutbox(config OutboxConfig) {
+	if len(config.EventTypes) == 0 {
+		config.EventTypes = []string{event.EVENT_RESOURCE_POST_CREATE, event.EVENT_RESOURCE_POST_UPDATE, event.EVENT_RESOURCE_POST_DELETE}
+	}
+	if config.Serialize == nil {
+		config.Serialize = serializeOutboxResource
+	}
+	for _, eventType := range config.EventTypes {
+		event.RegisterEventListener(event.EventListener{
+			Type: eventType,
+			Handler: func(c *gin.Context, e event.EventInterface) error {
+				rae, ok := e.(*event.ResourceActionEvent)
+				if !ok {
+					return nil
+				}
+				payload, err := json.Marshal(config.Serialize(rae.Resource))
+				if err != nil {
+					return err
+				}
+				return GetDB(c).Create(&OutboxMessage{
+					EventType:    rae.Action,
+					ResourceType: getResourceTypeName(rae.Resource),
+					Payload:      string(payload),
+				}).Error
+			},
+		})
+	}
+}
+
+// Create an outbox relay with default values
+func NewOutboxRelay(publisher Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		Publisher:   publisher,
+		Interval:    time.Second,
+		BatchSize:   100,
+		MaxAttempts: 10,
+	}
+}
+
+// Poll the outbox and publish the pending messages until the end of the context
+// The errors of a poll are reported with OnError, the next polls go on
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			r.reportError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report an error of a poll to OnError, or log it
+func (r *OutboxRelay) reportError(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+		return
+	}
+	log.Printf("outbox relay error: %v", err)
+}
+
+// Publish the pending messages once, returns the number of delivered messages
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	var messages []OutboxMessage
+	res := DB.WithContext(ctx).
+		Where("delivered_at IS NULL AND attempts < ?", r.MaxAttempts).
+		Order("id").
+		Limit(r.BatchSize).
+		Find(&messages)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	delivered := 0
+	for k := range messages {
+		m := &messages[k]
+		m.Attempts++
+		if err := r.Publisher.Publish(ctx, m); err != nil {
+			m.LastError = err.Error()
+		} else {
+			now := time.Now()
+			m.DeliveredAt = &now
+			m.LastError = ""
+			delivered++
+		}
+		res := DB.WithContext(ctx).Model(m).Select("attempts", "last_error", "delivered_at").Updates(m)
+		if res.Error != nil {
+			return delivered, res.Error
+		}
+	}
+	return delivered, nil
+}
+
+// Serialize a resource with the "one" group if it is aware of serialization
+func serializeOutboxResource(resource interface{}) interface{} {
+	if is, ok := resource.(layer.SerializeAware); ok {
+		return is.Serialize(&layer.SerializeGroups{
+			Values: []string{"one"},
+		})
+	}
+	return resource
+}
+
+// Returns the type name of a resource (ex: "User")
+func getResourceTypeName(resource interface{}) string {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Interface to implement to publish the outbox messages to another service
+type Publisher interface {
+	Publish(ctx context.Context, m *OutboxMessage) error
+}
+
+// Publisher calling a function of the application
+type InProcessPublisher func(ctx context.Context, m *OutboxMessage) error
+
+// Publisher appending the messages as json lines to a file
+type FilePublisher struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Publisher posting the messages in json to a webhook URL
+type WebhookPublisher struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// Implements Publisher
+func (p InProcessPublisher) Publish(ctx context.Context, m *OutboxMessage) error {
+	return p(ctx, m)
+}
+
+// Create a publisher appending the messages to a file
+func NewFilePublisher(path string) *FilePublisher {
+	return &FilePublisher{
+		Path: path,
+	}
+}
+
+// Implements Publisher
+func (p *FilePublisher) Publish(ctx context.Context, m *OutboxMessage) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.OpenFile(p.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Create a publisher posting the messages to a URL
+func NewWebhookPublisher(url string) *WebhookPublisher {
+	return &WebhookPublisher{
+		URL:    url,
+		Client: http.DefaultClient,
+	}
+}
+
+// Implements Publisher
+func (p *WebhookPublisher) Publish(ctx context.Context, m *OutboxMessage) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with status %d", p.URL, res.StatusCode)
+	}
+	return nil
+}
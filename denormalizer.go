@@ -0,0 +1,190 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+const (
+	// The fields the request cannot write are restored to their previous value
+	DENORMALIZE_MODE_IGNORE = "ignore"
+	// The fields the request cannot write give a validation error if their value is changed
+	DENORMALIZE_MODE_REJECT = "reject"
+)
+
+// Denormalization rules of the fields of the resource types
+var denormalizeFields sync.Map
+
+// Field of a resource with denormalization rules
+type denormalizeField struct {
+	Index []int
+	Name  string
+	Path  string
+	Rules []string
+}
+
+// Add denormalization groups to the ones of the operation of a request (ex: the roles of the user in a security middleware)
+func AddDenormalizeGroups(c *gin.Context, groups ...string) {
+	c.Set(CONTEXT_KEY_DENORMALIZE_GROUPS, append(c.GetStringSlice(CONTEXT_KEY_DENORMALIZE_GROUPS), groups...))
+}
+
+// Returns the denormalization groups of a request, the ones of its operation and the ones added to the context
+func GetDenormalizeGroups(c *gin.Context, previous interface{}) []string {
+	groups := GetResourceOptions(c).GetDenormalizeGroups(getGroupsOperation(c, previous))
+	return append(append([]string{}, groups...), c.GetStringSlice(CONTEXT_KEY_DENORMALIZE_GROUPS)...)
+}
+
+// Enforce the denormalization rules of a resource after its binding, previous is the resource before its update
+// The fields the request cannot write are restored to their previous value, their zero value on creation
+// In reject mode the ones set to another value give validation errors, returns true if fields are restored
+func denormalize(c *gin.Context, i interface{}, previous interface{}) ([]layer.ValidationError, bool) {
+	fields := getDenormalizeFields(reflect.TypeOf(i))
+	if len(fields) == 0 {
+		return nil, false
+	}
+	v := reflect.Indirect(reflect.ValueOf(i))
+	base := reflect.New(v.Type()).Elem()
+	if pv := reflect.Indirect(reflect.ValueOf(previous)); pv.IsValid() && pv.Type() == v.Type() {
+		base = pv
+	}
+	groups := GetDenormalizeGroups(c, previous)
+	reject := GetResourceOptions(c).DenormalizeMode == DENORMALIZE_MODE_REJECT
+
+	validationErrors := []layer.ValidationError{}
+	restored := false
+	for _, f := range fields {
+		tag := getDenormalizeViolation(f.Rules, groups)
+		if tag == "" {
+			continue
+		}
+		fv, bv := v.FieldByIndex(f.Index), base.FieldByIndex(f.Index)
+		if reflect.DeepEqual(fv.Interface(), bv.Interface()) {
+			continue
+		}
+		// the omitted fields have their previous value, a different value is sent by the request (zero values too)
+		if reject {
+			ve := NewLocalizedValidationError(c, tag, f.Name, "", i)
+			ve.Path = f.Path
+			if !isSensitiveField(v.Type().FieldByIndex(f.Index)) {
+				ve.Value = fv.Interface()
+			}
+			validationErrors = append(validationErrors, ve)
+			continue
+		}
+		fv.Set(bv)
+		restored = true
+	}
+	return validationErrors, restored
+}
+
+// Set the fields the request cannot write to their previous value before the binding of a resource replacing it
+// The fields omitted by the body keep their previous value, the ones sent are enforced by denormalize
+func presetDenormalizeFields(c *gin.Context, i interface{}, previous interface{}) {
+	fields := getDenormalizeFields(reflect.TypeOf(i))
+	v := reflect.Indirect(reflect.ValueOf(i))
+	if len(fields) == 0 || previous == nil {
+		return
+	}
+	// the values are copied, the binding must not write in the previous resource (ex: pointers)
+	pv := reflect.Indirect(reflect.ValueOf(utils.DeepCloneInterface(previous)))
+	if !pv.IsValid() || pv.Type() != v.Type() {
+		return
+	}
+	groups := GetDenormalizeGroups(c, previous)
+	for _, f := range fields {
+		if getDenormalizeViolation(f.Rules, groups) != "" {
+			v.FieldByIndex(f.Index).Set(pv.FieldByIndex(f.Index))
+		}
+	}
+}
+
+// Returns the rule forbidding the request to write a field, empty if it can write it
+func getDenormalizeViolation(rules []string, groups []string) string {
+	var required []string
+	for _, rule := range rules {
+		switch rule {
+		case layer.DENORMALIZE_READONLY:
+			return layer.DENORMALIZE_READONLY
+		case layer.DENORMALIZE_CREATEONLY:
+			if !containsAny([]string{layer.DENORMALIZE_GROUP_CREATE}, groups) {
+				return layer.DENORMALIZE_CREATEONLY
+			}
+		default:
+			required = append(required, rule)
+		}
+	}
+	if len(required) > 0 && !containsAny(required, groups) {
+		return layer.DENORMALIZE_FORBIDDEN
+	}
+	return ""
+}
+
+// Returns the fields of a resource type with denormalization rules, from their tags or GetDenormalizeRules
+func getDenormalizeFields(t reflect.Type) []denormalizeField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if fields, ok := denormalizeFields.Load(t); ok {
+		return fields.([]denormalizeField)
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var rules map[string]string
+	if da, ok := reflect.New(t).Interface().(layer.DenormalizeAware); ok {
+		rules = da.GetDenormalizeRules()
+	}
+	fields, _ := denormalizeFields.LoadOrStore(t, collectDenormalizeFields(t, nil, rules))
+	return fields.([]denormalizeField)
+}
+
+// Collect the fields of a struct type with denormalization rules, the embedded structs are flattened
+func collectDenormalizeFields(t reflect.Type, index []int, rules map[string]string) []denormalizeField {
+	fields := []denormalizeField{}
+	for k := 0; k < t.NumField(); k++ {
+		f := t.Field(k)
+		fieldIndex := append(append([]int{}, index...), k)
+		jsonName := utils.GetJSONName(f)
+		if f.Anonymous && jsonName == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, collectDenormalizeFields(f.Type, fieldIndex, rules)...)
+			continue
+		}
+		if f.PkgPath != "" || jsonName == "-" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+
+		tag, ok := rules[jsonName]
+		if !ok {
+			if tag, ok = rules[f.Name]; !ok {
+				tag = f.Tag.Get(layer.DENORMALIZE_TAG)
+			}
+		}
+		var fieldRules []string
+		for _, rule := range strings.Split(tag, ",") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				fieldRules = append(fieldRules, rule)
+			}
+		}
+		if len(fieldRules) > 0 {
+			fields = append(fields, denormalizeField{
+				Index: fieldIndex,
+				Name:  f.Name,
+				Path:  jsonName,
+				Rules: fieldRules,
+			})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,274 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+var (
+	ErrAsyncQueueFull  = errors.New("async listeners queue is full")
+	ErrAsyncPoolClosed = errors.New("async listeners pool is drained")
+	ErrAsyncPanic      = errors.New("async listener panicked")
+
+	asyncMu   sync.Mutex
+	asyncPool *workerPool
+
+	// Keys of the request context removed from the detached copies (ex: a database transaction)
+	requestScopedKeysMu sync.RWMutex
+	requestScopedKeys   []string
+)
+
+// Configuration of the worker pool running the asynchronous listeners
+type AsyncConfig struct {
+	// Number of workers, 4 by default
+	Workers int
+	// Number of jobs waiting for a worker, 100 by default
+	QueueSize int
+	// Number of retries of a failed listener
+	MaxRetries int
+	// Delay before the first retry, doubled at each retry
+	Backoff time.Duration
+	// Called with the jobs which failed after all retries or which could not be queued
+	DeadLetter func(job *AsyncJob, err error)
+}
+
+// Execution of an asynchronous listener, the context and the event are copies detached from the request
+type AsyncJob struct {
+	Listener  EventListener
+	EventType string
+	Event     EventInterface
+	Context   *gin.Context
+	Attempts  int
+}
+
+// Interface to implement in a custom event to copy it before an asynchronous execution
+type DetachableEventInterface interface {
+	Detach() EventInterface
+}
+
+type workerPool struct {
+	config  AsyncConfig
+	jobs    chan *AsyncJob
+	pending sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// Configure and start the worker pool of the asynchronous listeners, the previous pool is drained in background
+func ConfigureAsync(config AsyncConfig) {
+	asyncMu.Lock()
+	previous := asyncPool
+	asyncPool = newWorkerPool(config)
+	asyncMu.Unlock()
+
+	if previous != nil {
+		go previous.drain(context.Background())
+	}
+}
+
+// Stop accepting asynchronous jobs and wait for the running ones, until the end of the context
+func Drain(ctx context.Context) error {
+	asyncMu.Lock()
+	p := asyncPool
+	asyncMu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.drain(ctx)
+}
+
+// Returns the worker pool, it is started with the default configuration if not configured
+func getWorkerPool() *workerPool {
+	asyncMu.Lock()
+	defer asyncMu.Unlock()
+	if asyncPool == nil {
+		asyncPool = newWorkerPool(AsyncConfig{})
+	}
+	return asyncPool
+}
+
+func newWorkerPool(config AsyncConfig) *workerPool {
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	p := &workerPool{
+		config: config,
+		jobs:   make(chan *AsyncJob, config.QueueSize),
+	}
+	for i := 0; i < config.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Queue a job without blocking, it goes to the dead letter if the queue is full or the pool is drained
+func (p *workerPool) enqueue(job *AsyncJob) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.deadLetter(job, ErrAsyncPoolClosed)
+		return
+	}
+
+	p.pending.Add(1)
+	select {
+	case p.jobs <- job:
+	default:
+		p.pending.Done()
+		p.deadLetter(job, ErrAsyncQueueFull)
+	}
+}
+
+func (p *workerPool) work() {
+	for job := range p.jobs {
+		p.run(job)
+	}
+}
+
+// Run an attempt of a job, a failed job is queued again after its backoff delay while it has retries left
+// The workers do not wait for the retries, the job stays pending until its last attempt
+func (p *workerPool) run(job *AsyncJob) {
+	job.Attempts++
+	err := p.handle(job)
+	maxRetries, backoff := p.getRetryPolicy(job)
+	if err != nil && job.Attempts <= maxRetries {
+		delay := backoff << (job.Attempts - 1)
+		time.AfterFunc(delay, func() {
+			p.retry(job)
+		})
+		return
+	}
+	if err != nil {
+		p.deadLetter(job, err)
+	}
+	p.pending.Done()
+}
+
+// Returns the number of retries and the backoff of a job, the ones of its listener if set or the ones of the pool
+func (p *workerPool) getRetryPolicy(job *AsyncJob) (int, time.Duration) {
+	maxRetries, backoff := p.config.MaxRetries, p.config.Backoff
+	if job.Listener.MaxRetries > 0 {
+		maxRetries = job.Listener.MaxRetries
+	}
+	if job.Listener.Backoff > 0 {
+		backoff = job.Listener.Backoff
+	}
+	return maxRetries, backoff
+}
+
+// Queue a job again for a retry, it runs in the calling goroutine if the queue is full or the pool is drained
+func (p *workerPool) retry(job *AsyncJob) {
+	p.mu.RLock()
+	if !p.closed {
+		select {
+		case p.jobs <- job:
+			p.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	p.mu.RUnlock()
+	p.run(job)
+}
+
+// Run the listener of a job once, a panic is returned as an error
+func (p *workerPool) handle(job *AsyncJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrAsyncPanic, r)
+		}
+	}()
+	return job.Listener.Handler(job.Context, job.Event)
+}
+
+func (p *workerPool) deadLetter(job *AsyncJob, err error) {
+	if p.config.DeadLetter != nil {
+		p.config.DeadLetter(job, err)
+	}
+}
+
+func (p *workerPool) drain(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Register keys of the request context which are not valid after the request, they are removed from the copies given to the asynchronous listeners
+func RegisterRequestScopedKeys(keys ...string) {
+	requestScopedKeysMu.Lock()
+	defer requestScopedKeysMu.Unlock()
+	requestScopedKeys = append(requestScopedKeys, keys...)
+}
+
+// Queue an asynchronous listener with copies of the context and the event
+func dispatchAsync(c *gin.Context, eventType string, event EventInterface, el EventListener) {
+	var cc *gin.Context
+	if c != nil {
+		cc = detachContext(c)
+	}
+	getWorkerPool().enqueue(&AsyncJob{
+		Listener:  el,
+		EventType: eventType,
+		Event:     detachEvent(event, cc),
+		Context:   cc,
+	})
+}
+
+// Returns a copy of a request context without its request scoped keys
+func detachContext(c *gin.Context) *gin.Context {
+	cc := c.Copy()
+	requestScopedKeysMu.RLock()
+	defer requestScopedKeysMu.RUnlock()
+	for _, key := range requestScopedKeys {
+		delete(cc.Keys, key)
+	}
+	return cc
+}
+
+// Returns a copy of an event which can be used after the end of the request
+func detachEvent(event EventInterface, c *gin.Context) EventInterface {
+	switch e := event.(type) {
+	case *ResourceActionEvent:
+		cp := *e
+		cp.Resource = utils.DeepCloneInterface(e.Resource)
+		if e.Changes != nil {
+			cp.Changes = utils.DeepCloneInterface(e.Changes).(*ChangeSet)
+		}
+		return &cp
+	case *RequestEvent:
+		return &RequestEvent{
+			Context: c,
+		}
+	case DetachableEventInterface:
+		return e.Detach()
+	}
+	return event
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+)
+
+// Change of a field between the previous and the new state of a resource
+type FieldChange struct {
+	// Name of the field in json (or the struct field name if it has no json name)
+	Field string
+	// Name of the struct field
+	Name string
+	From interface{}
+	To   interface{}
+}
+
+// Set of the changes of a resource update
+type ChangeSet struct {
+	Previous interface{}
+	Changes  map[string]FieldChange
+}
+
+// Create the change set between the previous and the new state of a resource
+// The fields of the uuid bindings are ignored, their uuid field holds the change
+func NewChangeSet(from interface{}, to interface{}) *ChangeSet {
+	cs := &ChangeSet{
+		Previous: from,
+		Changes:  map[string]FieldChange{},
+	}
+	fv, tv := reflect.Indirect(reflect.ValueOf(from)), reflect.Indirect(reflect.ValueOf(to))
+	if fv.Kind() != reflect.Struct || fv.Type() != tv.Type() {
+		return cs
+	}
+	bindings := map[interface{}]bool{}
+	if ib, ok := to.(layer.UUIDBinderInterface); ok {
+		for _, b := range ib.GetUUIDBindings() {
+			bindings[b.BindTo] = true
+		}
+	}
+	cs.diff(fv, tv, bindings)
+	return cs
+}
+
+// Returns true if the field has changed, field is the json name or the struct field name
+func (cs *ChangeSet) Has(field string) bool {
+	_, ok := cs.Get(field)
+	return ok
+}
+
+// Returns the change of a field, field is the json name or the struct field name
+func (cs *ChangeSet) Get(field string) (FieldChange, bool) {
+	if fc, ok := cs.Changes[field]; ok {
+		return fc, true
+	}
+	for _, fc := range cs.Changes {
+		if fc.Name == field {
+			return fc, true
+		}
+	}
+	return FieldChange{}, false
+}
+
+// Returns the sorted list of the changed fields
+func (cs *ChangeSet) Fields() []string {
+	fields := make([]string, 0, len(cs.Changes))
+	for f := range cs.Changes {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Compare the fields of two structs of the same type, embedded structs are flattened
+func (cs *ChangeSet) diff(from reflect.Value, to reflect.Value, bindings map[interface{}]bool) {
+	t := from.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			cs.diff(from.Field(i), to.Field(i), bindings)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if to.Field(i).CanAddr() && bindings[to.Field(i).Addr().Interface()] {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fi, ti := from.Field(i).Interface(), to.Field(i).Interface()
+		if isEqual(fi, ti) {
+			continue
+		}
+		cs.Changes[name] = FieldChange{
+			Field: name,
+			Name:  f.Name,
+			From:  fi,
+			To:    ti,
+		}
+	}
+}
+
+func isEqual(a interface{}, b interface{}) bool {
+	if ta, ok := a.(time.Time); ok {
+		return ta.Equal(b.(time.Time))
+	}
+	return reflect.DeepEqual(a, b)
+}
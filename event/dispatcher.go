@@ -0,0 +1,109 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CONTEXT_KEY_DISPATCHER = "ctx.event.dispatcher"
+)
+
+// Global dispatcher of the application listeners
+var globalDispatcher = NewDispatcher()
+
+// Dispatcher holds event listeners by type, it is safe for concurrent use
+// The listeners of a type are sorted by priority at registration
+type Dispatcher struct {
+	mu        sync.RWMutex
+	listeners map[string][]EventListener
+}
+
+// Create an empty dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		listeners: map[string][]EventListener{},
+	}
+}
+
+// Returns the global dispatcher, used for the application listeners
+func GetDispatcher() *Dispatcher {
+	return globalDispatcher
+}
+
+// Returns the dispatcher of a request, it is created if the request has none
+func GetRequestDispatcher(c *gin.Context) *Dispatcher {
+	if d, ok := c.Get(CONTEXT_KEY_DISPATCHER); ok {
+		return d.(*Dispatcher)
+	}
+	d := NewDispatcher()
+	c.Set(CONTEXT_KEY_DISPATCHER, d)
+	return d
+}
+
+// Register a listener, the listeners with the same priority keep their registration order
+func (d *Dispatcher) Register(el EventListener) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// the slice is copied to keep the one returned by Listeners unchanged
+	current := d.listeners[el.Type]
+	idx := sort.Search(len(current), func(i int) bool {
+		return current[i].Priority < el.Priority
+	})
+	listeners := make([]EventListener, 0, len(current)+1)
+	listeners = append(listeners, current[:idx]...)
+	listeners = append(listeners, el)
+	listeners = append(listeners, current[idx:]...)
+	d.listeners[el.Type] = listeners
+}
+
+// Returns the listeners of an event type sorted by priority, the result must not be modified
+func (d *Dispatcher) Listeners(eventType string) []EventListener {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.listeners[eventType]
+}
+
+// Remove all the listeners
+func (d *Dispatcher) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.listeners = map[string][]EventListener{}
+}
+
+// Returns the listeners of an event type for a request, the global and the request ones merged by priority
+func getListeners(c *gin.Context, eventType string) []EventListener {
+	global := globalDispatcher.Listeners(eventType)
+	if c == nil {
+		return global
+	}
+	d, ok := c.Get(CONTEXT_KEY_DISPATCHER)
+	if !ok {
+		return global
+	}
+	local := d.(*Dispatcher).Listeners(eventType)
+	if len(local) == 0 {
+		return global
+	}
+
+	listeners := make([]EventListener, 0, len(global)+len(local))
+	i, j := 0, 0
+	for i < len(global) && j < len(local) {
+		if global[i].Priority >= local[j].Priority {
+			listeners = append(listeners, global[i])
+			i++
+		} else {
+			listeners = append(listeners, local[j])
+			j++
+		}
+	}
+	listeners = append(listeners, global[i:]...)
+	return append(listeners, local[j:]...)
+}
@@ -5,22 +5,22 @@
 package event
 
 import (
-	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var eventsListeners map[string][]EventListener
-
 // Interface to implment to create a type of event
 type EventInterface interface {
 	GetParentEventType() string
 }
 
 // Type of Event to handle actions of resource
+// Changes is set for the update actions, with the changes from the previous state of the resource
 type ResourceActionEvent struct {
 	Resource interface{}
 	Action   string
+	Changes  *ChangeSet
 }
 
 // Type of Event to handle requests events
@@ -28,11 +28,16 @@ type RequestEvent struct {
 	Context *gin.Context
 }
 
-// Event listener to add on list of eventsListeners
+// Event listener to register in a Dispatcher
+// An Async listener runs in the worker pool after the dispatch, its error does not stop the dispatch
+// MaxRetries and Backoff replace the ones of the worker pool for an Async listener if set
 type EventListener struct {
-	Type     string
-	Handler  func(c *gin.Context, e EventInterface) error
-	Priority int
+	Type       string
+	Handler    func(c *gin.Context, e EventInterface) error
+	Priority   int
+	Async      bool
+	MaxRetries int
+	Backoff    time.Duration
 }
 
 // Get parent type of the event
@@ -45,21 +50,32 @@ func (rae *RequestEvent) GetParentEventType() string {
 	return ""
 }
 
-// Reset event listeners
+// Reset the global event listeners
 func ResetEventListeners() {
-	eventsListeners = map[string][]EventListener{}
+	globalDispatcher.Reset()
 }
 
-// Register a new listener
+// Register a new global listener
 func RegisterEventListener(el EventListener) {
-	if _, ok := eventsListeners[el.Type]; !ok {
-		eventsListeners[el.Type] = []EventListener{}
-	}
-	eventsListeners[el.Type] = append(eventsListeners[el.Type], el)
+	globalDispatcher.Register(el)
+}
+
+// Register a new listener for the lifetime of a request
+func RegisterRequestEventListener(c *gin.Context, el EventListener) {
+	GetRequestDispatcher(c).Register(el)
 }
 
 // Dispatch an event and browse the list of registered event listeners to apply the handler
+// The error of a listener is added to the errors of the gin context
 func DispatchEvent(c *gin.Context, eventType string, event EventInterface) error {
+	err := dispatchEventWithParent(c, eventType, event)
+	if err != nil && c != nil {
+		c.Error(err)
+	}
+	return err
+}
+
+func dispatchEventWithParent(c *gin.Context, eventType string, event EventInterface) error {
 	// dispatch parent event
 	if event.GetParentEventType() != "" {
 		err := dispatchEvent(c, event.GetParentEventType(), event)
@@ -71,13 +87,11 @@ func DispatchEvent(c *gin.Context, eventType string, event EventInterface) error
 }
 
 func dispatchEvent(c *gin.Context, eventType string, event EventInterface) error {
-	if _, ok := eventsListeners[eventType]; !ok {
-		return nil
-	}
-	sort.SliceStable(eventsListeners[eventType], func(i, j int) bool {
-		return eventsListeners[eventType][i].Priority > eventsListeners[eventType][j].Priority
-	})
-	for _, el := range eventsListeners[eventType] {
+	for _, el := range getListeners(c, eventType) {
+		if el.Async {
+			dispatchAsync(c, eventType, event, el)
+			continue
+		}
 		err := el.Handler(c, event)
 		if err != nil {
 			return err
@@ -85,7 +99,3 @@ func dispatchEvent(c *gin.Context, eventType string, event EventInterface) error
 	}
 	return nil
 }
-
-func init() {
-	ResetEventListeners()
-}
@@ -12,6 +12,7 @@ const (
 	EVENT_RESOURCE_PRE_UPDATE  = "resource.pre_update"
 	EVENT_RESOURCE_POST_UPDATE = "resource.post_update"
 	EVENT_RESOURCE_PRE_DELETE  = "resource.pre_delete"
+	EVENT_RESOURCE_POST_DELETE = "resource.post_delete"
 	EVENT_RESOURCE_ACTION      = "resource.action"
 
 	// Request events
@@ -5,15 +5,89 @@
 package easyapi
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/i18n"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
 )
 
+const (
+	MIME_PROBLEM_JSON = "application/problem+json"
+)
+
+var (
+	ErrorConfig = &errorConfig{
+		// If true the errors are written in the legacy format {"error": {code, message, data}}
+		Legacy: false,
+		// Base URI of the problem types, the type of a problem is this URI followed by its error code
+		// The type is "about:blank" if empty
+		TypeBaseURI: "",
+	}
+)
+
+// Error config
+type errorConfig struct {
+	Legacy      bool
+	TypeBaseURI string
+}
+
 type httpError struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	Code      int         `json:"code"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data"`
+	ErrorCode string      `json:"-"`
+}
+
+// Problem details of an error (RFC 7807), Code is the stable error code
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     string      `json:"code"`
+	Errors   interface{} `json:"errors,omitempty"`
+}
+
+// Constraint violations of the DAOs, with their status, error code, message and validation tag
+var constraintErrorMappings = []struct {
+	Type    string
+	Status  int
+	Code    string
+	Message string
+	Tag     string
+}{
+	{dao.CONSTRAINT_UNIQUE, http.StatusConflict, layer.ERROR_CODE_DUPLICATE_KEY, "Resource already exists", "unique"},
+	{dao.CONSTRAINT_REFERENCED, http.StatusConflict, layer.ERROR_CODE_STILL_REFERENCED, "Resource is still referenced", "referenced"},
+	{dao.CONSTRAINT_FOREIGN_KEY, http.StatusUnprocessableEntity, layer.ERROR_CODE_FOREIGN_KEY_VIOLATION, "Referenced resource not found", "exists"},
+	{dao.CONSTRAINT_NOT_NULL, http.StatusUnprocessableEntity, layer.ERROR_CODE_NOT_NULL_VIOLATION, "Missing required value", "required"},
+}
+
+// Register the mappings of the constraint violations of the DAOs, the response contains a validation error for the field
+func init() {
+	for _, cm := range constraintErrorMappings {
+		cm := cm
+		layer.RegisterErrorMapping(layer.ErrorMapping{
+			Match: func(err error) bool {
+				var ce *dao.ConstraintError
+				return errors.As(err, &ce) && ce.Type == cm.Type
+			},
+			Status:  cm.Status,
+			Code:    cm.Code,
+			Message: cm.Message,
+			Errors: func(err error) []layer.ValidationError {
+				var ce *dao.ConstraintError
+				if !errors.As(err, &ce) || ce.Field == "" {
+					return nil
+				}
+				return []layer.ValidationError{NewValidationError(cm.Tag, ce.Field, nil)}
+			},
+		})
+	}
 }
 
 // Implements the Error interface
@@ -22,16 +96,80 @@ func (e *httpError) Error() string {
 }
 
 // Create a http error and display it on gin context
+// The error code is the one of the status, or validation_failed if data contains validation errors
 func HttpError(c *gin.Context, code int, message string, data interface{}) error {
+	errorCode := layer.GetStatusErrorCode(code)
+	if _, ok := data.([]layer.ValidationError); ok {
+		errorCode = layer.ERROR_CODE_VALIDATION_FAILED
+	}
+	return HttpErrorWithCode(c, code, errorCode, message, data)
+}
+
+// Create a http error with an error code and display it on gin context
+// The message is replaced by the message of the key error.<errorCode> of the i18n catalogs if any, its params are Message and Status
+func HttpErrorWithCode(c *gin.Context, code int, errorCode string, message string, data interface{}) error {
 	if message == "" {
 		message = "An error occured"
 	}
+	message = i18n.T(c, i18n.ERROR_KEY_PREFIX+errorCode, map[string]interface{}{
+		"Message": message,
+		"Status":  code,
+	}, message)
 	e := &httpError{
-		Code:    code,
-		Message: message,
-		Data:    data,
+		Code:      code,
+		Message:   message,
+		Data:      data,
+		ErrorCode: errorCode,
+	}
+
+	if ErrorConfig.Legacy {
+		c.JSON(code, gin.H{"error": e})
+		return e
+	}
+
+	p := &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(code),
+		Status:   code,
+		Detail:   message,
+		Instance: c.Request.URL.Path,
+		Code:     errorCode,
+		Errors:   data,
+	}
+	if ErrorConfig.TypeBaseURI != "" {
+		p.Type = ErrorConfig.TypeBaseURI + errorCode
 	}
-	c.JSON(code, gin.H{"error": e})
+	c.Header("Content-Type", MIME_PROBLEM_JSON)
+	c.JSON(code, p)
 
 	return e
 }
+
+// Create a http error from a Go error and display it on gin context
+// The status and the error code are given by the error mapping matching err, the given ones are used otherwise
+func HttpErrorFromError(c *gin.Context, err error, code int, errorCode string, message string) error {
+	if err != nil {
+		c.Error(err)
+	}
+	var data interface{}
+	if m, ok := layer.ResolveError(err); ok {
+		code, errorCode = m.Status, m.Code
+		if m.Message != "" {
+			message = m.Message
+		}
+		if m.Errors != nil {
+			if validationErrors := m.Errors(err); len(validationErrors) > 0 {
+				data = validationErrors
+			}
+		}
+	}
+	return HttpErrorWithCode(c, code, errorCode, message, data)
+}
+
+// Returns the error code of an error returned by HttpError, empty if it is not one
+func GetErrorCode(err error) string {
+	if e, ok := err.(*httpError); ok {
+		return e.ErrorCode
+	}
+	return ""
+}
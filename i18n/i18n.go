@@ -0,0 +1,195 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Message catalogs by locale, the messages are text/template templates (ex: "Field {{.Field}} must be at least {{.Param}}")
+
+package i18n
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	Config = &config{
+		// Locale used when the locale of a request has no catalog or no message for a key
+		DefaultLocale: "en",
+	}
+
+	catalogsMu sync.RWMutex
+	catalogs   = map[string]map[string]string{}
+	templates  sync.Map
+)
+
+// I18n config
+type config struct {
+	DefaultLocale string
+}
+
+// Add messages to the catalog of a locale, the existing keys are replaced
+func AddMessages(locale string, messages map[string]string) {
+	locale = normalizeLocale(locale)
+	catalogsMu.Lock()
+	defer catalogsMu.Unlock()
+	if _, ok := catalogs[locale]; !ok {
+		catalogs[locale] = map[string]string{}
+	}
+	for key, message := range messages {
+		catalogs[locale][key] = message
+		templates.Delete(locale + ":" + key)
+	}
+}
+
+// Load the messages of a locale from a JSON or YAML file, nested keys are joined with dots (ex: validation.required)
+func LoadFile(locale string, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("unsupported catalog file %s", path)
+	}
+	if err != nil {
+		return err
+	}
+	messages := map[string]string{}
+	flatten("", doc, messages)
+	AddMessages(locale, messages)
+	return nil
+}
+
+// Load the catalogs of a directory, the files are named by their locale (ex: fr.json, en-US.yaml)
+func LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		if err := LoadFile(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())), filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the locales having a catalog
+func GetLocales() []string {
+	catalogsMu.RLock()
+	defer catalogsMu.RUnlock()
+	locales := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	return locales
+}
+
+// Translate a message key with its params, false if no catalog has the key
+// The catalogs are looked up in this order : the locale (ex: fr-CH), its language (ex: fr), the default locale
+func Translate(locale string, key string, params interface{}) (string, bool) {
+	for _, l := range fallbackLocales(locale) {
+		if message, ok := translate(l, key, params); ok {
+			return message, true
+		}
+	}
+	return "", false
+}
+
+// Translate a message key with its params, or returns the fallback if no catalog has the key
+func TranslateOr(locale string, key string, params interface{}, fallback string) string {
+	if message, ok := Translate(locale, key, params); ok {
+		return message
+	}
+	return fallback
+}
+
+// Returns true if a locale has a catalog, its language is not looked up (ex: fr-CH is false with a catalog fr only)
+func HasLocale(locale string) bool {
+	catalogsMu.RLock()
+	defer catalogsMu.RUnlock()
+	_, ok := catalogs[normalizeLocale(locale)]
+	return ok
+}
+
+// Execute the template of a key in the catalog of a locale
+func translate(locale string, key string, params interface{}) (string, bool) {
+	cacheKey := locale + ":" + key
+	t, ok := templates.Load(cacheKey)
+	if !ok {
+		catalogsMu.RLock()
+		message, found := catalogs[locale][key]
+		catalogsMu.RUnlock()
+		if !found {
+			return "", false
+		}
+		parsed, err := template.New(key).Option("missingkey=zero").Parse(message)
+		if err != nil {
+			return message, true
+		}
+		t, _ = templates.LoadOrStore(cacheKey, parsed)
+	}
+	var b bytes.Buffer
+	if err := t.(*template.Template).Execute(&b, params); err != nil {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// Returns the locales to look up for a locale
+func fallbackLocales(locale string) []string {
+	locale = normalizeLocale(locale)
+	locales := []string{}
+	if locale != "" {
+		locales = append(locales, locale)
+		if k := strings.Index(locale, "-"); k > 0 {
+			locales = append(locales, locale[:k])
+		}
+	}
+	return append(locales, normalizeLocale(Config.DefaultLocale))
+}
+
+// Normalize a locale (ex: fr_fr gives fr-FR)
+func normalizeLocale(locale string) string {
+	parts := strings.SplitN(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-", 2)
+	parts[0] = strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		parts[1] = strings.ToUpper(parts[1])
+	}
+	return strings.Join(parts, "-")
+}
+
+// Flatten nested messages, the keys are joined with dots
+func flatten(prefix string, doc map[string]interface{}, messages map[string]string) {
+	for k, v := range doc {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch value := v.(type) {
+		case map[string]interface{}:
+			flatten(key, value, messages)
+		case string:
+			messages[key] = value
+		default:
+			messages[key] = fmt.Sprint(value)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CONTEXT_KEY_LOCALE = "ctx.i18n.locale"
+)
+
+// Returns the locale of a request, negotiated from the Accept-Language header and kept in the context
+// It is the default locale if the context is nil
+func GetLocale(c *gin.Context) string {
+	if c == nil {
+		return Config.DefaultLocale
+	}
+	if l, ok := c.Get(CONTEXT_KEY_LOCALE); ok {
+		return l.(string)
+	}
+	locale := Negotiate(c.GetHeader("Accept-Language"))
+	c.Set(CONTEXT_KEY_LOCALE, locale)
+	return locale
+}
+
+// Set the locale of a request, it replaces the negotiated one (ex: the locale of the user)
+func SetLocale(c *gin.Context, locale string) {
+	c.Set(CONTEXT_KEY_LOCALE, normalizeLocale(locale))
+}
+
+// Translate a message key in the locale of a request, or returns the fallback if no catalog has the key
+func T(c *gin.Context, key string, params interface{}, fallback string) string {
+	return TranslateOr(GetLocale(c), key, params, fallback)
+}
+
+// Returns the best locale having a catalog for an Accept-Language header (ex: "fr-CH, fr;q=0.9, en;q=0.8"), the default locale otherwise
+func Negotiate(acceptLanguage string) string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var candidates []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := strings.TrimSpace(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			if v := strings.TrimSpace(f); strings.HasPrefix(v, "q=") {
+				if parsed, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	for _, c := range candidates {
+		locale := normalizeLocale(c.locale)
+		if HasLocale(locale) {
+			return locale
+		}
+		if k := strings.Index(locale, "-"); k > 0 && HasLocale(locale[:k]) {
+			return locale[:k]
+		}
+	}
+	return Config.DefaultLocale
+}
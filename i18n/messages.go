@@ -0,0 +1,40 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package i18n
+
+const (
+	// Prefix of the keys of the validation messages, followed by the validation tag (ex: validation.required)
+	VALIDATION_KEY_PREFIX = "validation."
+	// Key of the validation message of the tags without message
+	VALIDATION_KEY_DEFAULT = "validation.default"
+	// Prefix of the keys of the error messages, followed by the error code (ex: error.not_found)
+	ERROR_KEY_PREFIX = "error."
+)
+
+// Default english validation messages, the params are Field, Tag and Param
+var defaultMessages = map[string]string{
+	VALIDATION_KEY_DEFAULT:               "Field {{.Field}} failed with condition `{{.Tag}}`",
+	VALIDATION_KEY_PREFIX + "required":   "Field {{.Field}} is required",
+	VALIDATION_KEY_PREFIX + "email":      "Field {{.Field}} must be a valid email address",
+	VALIDATION_KEY_PREFIX + "url":        "Field {{.Field}} must be a valid URL",
+	VALIDATION_KEY_PREFIX + "uuid":       "Field {{.Field}} must be a valid UUID",
+	VALIDATION_KEY_PREFIX + "len":        "Field {{.Field}} must have a length of {{.Param}}",
+	VALIDATION_KEY_PREFIX + "min":        "Field {{.Field}} must be at least {{.Param}}",
+	VALIDATION_KEY_PREFIX + "max":        "Field {{.Field}} must be at most {{.Param}}",
+	VALIDATION_KEY_PREFIX + "gte":        "Field {{.Field}} must be greater than or equal to {{.Param}}",
+	VALIDATION_KEY_PREFIX + "lte":        "Field {{.Field}} must be less than or equal to {{.Param}}",
+	VALIDATION_KEY_PREFIX + "gt":         "Field {{.Field}} must be greater than {{.Param}}",
+	VALIDATION_KEY_PREFIX + "lt":         "Field {{.Field}} must be less than {{.Param}}",
+	VALIDATION_KEY_PREFIX + "oneof":      "Field {{.Field}} must be one of {{.Param}}",
+	VALIDATION_KEY_PREFIX + "unique":     "Field {{.Field}} must be unique",
+	VALIDATION_KEY_PREFIX + "exists":     "Field {{.Field}} references a missing resource",
+	VALIDATION_KEY_PREFIX + "readonly":   "Field {{.Field}} is read-only",
+	VALIDATION_KEY_PREFIX + "createonly": "Field {{.Field}} can only be set on creation",
+	VALIDATION_KEY_PREFIX + "forbidden":  "Field {{.Field}} cannot be written",
+}
+
+func init() {
+	AddMessages("en", defaultMessages)
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/schema"
+)
+
+const (
+	MIME_SCHEMA_JSON = "application/schema+json"
+)
+
+var (
+	// Generated schemas by resource type
+	resourceSchemas        sync.Map
+	resourcePartialSchemas sync.Map
+	pointerUnescaper       = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// Gin handler returning the JSON Schema of a resource
+func HandleSchema(c *gin.Context, i interface{}) {
+	c.Header("Content-Type", MIME_SCHEMA_JSON)
+	c.JSON(http.StatusOK, GetResourceSchema(i))
+}
+
+// Returns the JSON Schema of a resource, it is generated once by type and must not be modified
+func GetResourceSchema(i interface{}) *schema.Schema {
+	t := reflect.TypeOf(i)
+	if s, ok := resourceSchemas.Load(t); ok {
+		return s.(*schema.Schema)
+	}
+	s := schema.Generate(i)
+	s.Title = schema.TypeName(i)
+	actual, _ := resourceSchemas.LoadOrStore(t, s)
+	return actual.(*schema.Schema)
+}
+
+// Returns the JSON Schema of a partial update of a resource, without the required properties
+func getResourcePartialSchema(i interface{}) *schema.Schema {
+	t := reflect.TypeOf(i)
+	if s, ok := resourcePartialSchemas.Load(t); ok {
+		return s.(*schema.Schema)
+	}
+	actual, _ := resourcePartialSchemas.LoadOrStore(t, GetResourceSchema(i).Partial())
+	return actual.(*schema.Schema)
+}
+
+// Validate a request body against the JSON Schema of a resource if enabled in the resource options
+// The body of a partial update is validated without the required properties, the bound resource is validated after
+func validateSchema(c *gin.Context, i interface{}, body []byte, partial bool) []layer.ValidationError {
+	if !GetResourceOptions(c).ValidateSchema {
+		return nil
+	}
+	s := GetResourceSchema(i)
+	if partial {
+		s = getResourcePartialSchema(i)
+	}
+	errs, err := s.ValidateJSON(body)
+	if err != nil {
+		return []layer.ValidationError{NewLocalizedValidationError(c, "", err.Error(), "", i)}
+	}
+	validationErrors := []layer.ValidationError{}
+	for _, e := range errs {
+		field := pointerUnescaper.Replace(e.Pointer[strings.LastIndex(e.Pointer, "/")+1:])
+		ve := NewLocalizedValidationError(c, e.Keyword, field, "", i)
+		ve.Pointer, ve.Path = e.Pointer, getPointerPath(e.Pointer)
+		validationErrors = append(validationErrors, ve)
+	}
+	return validationErrors
+}
+
+// Returns true if the body of a request is a partial update of the resource (PATCH, bulk PATCH)
+func isPartialUpdate(c *gin.Context) bool {
+	switch c.GetString(CONTEXT_KEY_OPERATION) {
+	case OPERATION_UPDATE, OPERATION_BULK_UPDATE:
+		return true
+	}
+	return false
+}
+
+// Returns the JSON path of a JSON pointer (ex: /items/3/qty gives items[3].qty)
+func getPointerPath(pointer string) string {
+	var path strings.Builder
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(token); err == nil {
+			path.WriteString("[" + token + "]")
+			continue
+		}
+		if path.Len() > 0 {
+			path.WriteString(".")
+		}
+		path.WriteString(pointerUnescaper.Replace(token))
+	}
+	return path.String()
+}
@@ -4,7 +4,37 @@
 
 package layer
 
-import "github.com/google/uuid"
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// Tag of the validation groups of a field, its binding rules are checked only if one of its groups is enabled
+	VALIDATION_GROUPS_TAG = "validation_groups"
+
+	// Validation groups enabled by default on creation and on update
+	VALIDATION_GROUP_CREATE = "create"
+	VALIDATION_GROUP_UPDATE = "update"
+
+	// Tag of the denormalization rules of a field (ex: `denormalize:"createonly,admin"`)
+	// The rules are readonly, createonly, or the denormalization groups of which one is required to write the field
+	DENORMALIZE_TAG        = "denormalize"
+	DENORMALIZE_READONLY   = "readonly"
+	DENORMALIZE_CREATEONLY = "createonly"
+	// Validation tag of a field written without one of its denormalization groups
+	DENORMALIZE_FORBIDDEN = "forbidden"
+
+	// Tag of a field whose value is never sent in the validation errors (ex: `sensitive:"true"`)
+	// The values of the fields never serialized (`json:"-"`, `groups:"-"`) are not sent either
+	SENSITIVE_TAG = "sensitive"
+
+	// Denormalization groups enabled by default on creation and on update
+	DENORMALIZE_GROUP_CREATE = "create"
+	DENORMALIZE_GROUP_UPDATE = "update"
+)
 
 // Object to return in resources to configure bindings of the resource
 type UUIDBinding struct {
@@ -13,11 +43,37 @@ type UUIDBinding struct {
 	Name   string
 }
 
-// Validation error
+// Validation error, Index is the position of the resource in a bulk request
+// Pointer is the JSON pointer of the invalid value when the body is validated against the JSON Schema of the resource
+// Param is the param of the tag (ex: 8 for min=8)
+// Path is the JSON path of the field with the json names (ex: items[3].qty) and Value is the rejected value, empty for the sensitive fields
 type ValidationError struct {
-	Tag     string `json:"tag"`
-	Field   string `json:"field"`
-	Message string `json:"message"`
+	Tag     string      `json:"tag"`
+	Field   string      `json:"field"`
+	Message string      `json:"message"`
+	Index   *int        `json:"index,omitempty"`
+	Pointer string      `json:"pointer,omitempty"`
+	Param   string      `json:"param,omitempty"`
+	Path    string      `json:"path,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+}
+
+// Error of a validator which could not check a field (ex: the query of its DAO failed)
+// A validator reports it in the errors of the gin context, the request fails with it instead of a validation error
+type ValidatorError struct {
+	Tag   string
+	Field string
+	Err   error
+}
+
+// Implements the Error interface
+func (e *ValidatorError) Error() string {
+	return fmt.Sprintf("validator %s of field %s failed: %s", e.Tag, e.Field, e.Err)
+}
+
+// Returns the error of the validator
+func (e *ValidatorError) Unwrap() error {
+	return e.Err
 }
 
 // Interface to implement in a resource to configure bindings
@@ -30,3 +86,34 @@ type ValidationAwareInterface interface {
 	Validate() []ValidationError
 	GetCustomValidationMessages() map[string]string
 }
+
+// Context of the validation of a resource in a request
+// Previous is the resource before its update (PATCH, PUT, bulk PATCH), nil on creation, Token is the token information of the request if any
+type ValidationContext struct {
+	Operation string
+	Groups    []string
+	Context   *gin.Context
+	Token     interface{}
+	Previous  interface{}
+}
+
+// Returns true if a validation group is enabled
+func (vc *ValidationContext) HasGroup(group string) bool {
+	for _, g := range vc.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Interface to implement in a resource to configure validation with the context of the request
+type ContextualValidationAware interface {
+	ValidateWithContext(vc *ValidationContext) []ValidationError
+}
+
+// Interface to implement in a resource to configure the denormalization rules of its fields without tags
+// The keys are the json names or the names of the fields and the values are rules like the ones of the tag (ex: "createonly,admin")
+type DenormalizeAware interface {
+	GetDenormalizeRules() map[string]string
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package layer
+
+import (
+	"net/http"
+	"sync"
+)
+
+const (
+	// Error codes, they are stable and can be used by the clients
+	ERROR_CODE_BAD_REQUEST            = "bad_request"
+	ERROR_CODE_UNAUTHORIZED           = "unauthorized"
+	ERROR_CODE_FORBIDDEN              = "forbidden"
+	ERROR_CODE_NOT_FOUND              = "not_found"
+	ERROR_CODE_CONFLICT               = "conflict"
+	ERROR_CODE_UNSUPPORTED_MEDIA_TYPE = "unsupported_media_type"
+	ERROR_CODE_UNPROCESSABLE          = "unprocessable_entity"
+	ERROR_CODE_INTERNAL               = "internal_error"
+	ERROR_CODE_VALIDATION_FAILED      = "validation_failed"
+	ERROR_CODE_INVALID_FILTER         = "invalid_filter"
+	ERROR_CODE_INVALID_PATCH          = "invalid_patch"
+	ERROR_CODE_INVALID_FIELDS         = "invalid_fields"
+	ERROR_CODE_INVALID_EXPAND         = "invalid_expand"
+	ERROR_CODE_CREATE_FAILED          = "create_failed"
+	ERROR_CODE_UPDATE_FAILED          = "update_failed"
+	ERROR_CODE_DELETE_FAILED          = "delete_failed"
+	ERROR_CODE_LIST_FAILED            = "list_failed"
+	ERROR_CODE_DUPLICATE_KEY          = "duplicate_key"
+	ERROR_CODE_FOREIGN_KEY_VIOLATION  = "foreign_key_violation"
+	ERROR_CODE_STILL_REFERENCED       = "still_referenced"
+	ERROR_CODE_NOT_NULL_VIOLATION     = "not_null_violation"
+)
+
+var (
+	errorMappingsMu sync.RWMutex
+	errorMappings   []ErrorMapping
+
+	// Default error codes of the http statuses
+	statusErrorCodes = map[int]string{
+		http.StatusBadRequest:           ERROR_CODE_BAD_REQUEST,
+		http.StatusUnauthorized:         ERROR_CODE_UNAUTHORIZED,
+		http.StatusForbidden:            ERROR_CODE_FORBIDDEN,
+		http.StatusNotFound:             ERROR_CODE_NOT_FOUND,
+		http.StatusConflict:             ERROR_CODE_CONFLICT,
+		http.StatusUnsupportedMediaType: ERROR_CODE_UNSUPPORTED_MEDIA_TYPE,
+		http.StatusUnprocessableEntity:  ERROR_CODE_UNPROCESSABLE,
+		http.StatusInternalServerError:  ERROR_CODE_INTERNAL,
+	}
+)
+
+// Mapping of Go errors to a http status and an error code
+// Message replaces the message of the response if set, the error itself is never sent to the client
+// Errors returns the validation errors of the response, it is optional
+type ErrorMapping struct {
+	Match   func(err error) bool
+	Status  int
+	Code    string
+	Message string
+	Errors  func(err error) []ValidationError
+}
+
+// Register an error mapping, the mappings registered last are checked first
+func RegisterErrorMapping(m ErrorMapping) {
+	errorMappingsMu.Lock()
+	defer errorMappingsMu.Unlock()
+	errorMappings = append([]ErrorMapping{m}, errorMappings...)
+}
+
+// Returns the mapping of an error, false if no mapping matches it
+func ResolveError(err error) (ErrorMapping, bool) {
+	if err == nil {
+		return ErrorMapping{}, false
+	}
+	errorMappingsMu.RLock()
+	defer errorMappingsMu.RUnlock()
+	for _, m := range errorMappings {
+		if m.Match(err) {
+			return m, true
+		}
+	}
+	return ErrorMapping{}, false
+}
+
+// Returns true if an error is mapped to the not found error code (ex: a record not found by a DAO)
+func IsNotFoundError(err error) bool {
+	m, ok := ResolveError(err)
+	return ok && m.Code == ERROR_CODE_NOT_FOUND
+}
+
+// Returns the default error code of a http status
+func GetStatusErrorCode(status int) string {
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return ERROR_CODE_INTERNAL
+	}
+	return ERROR_CODE_BAD_REQUEST
+}
@@ -17,12 +17,17 @@ type QueryFilterAware interface {
 	GetQueryFilterSet() QueryFilterSet
 }
 
+// Function type to implement to match a filter on a resource in memory (ex: for the change feeds)
+type QueryFilterMatchFunc func(resource interface{}, param string, value string, args interface{}) bool
+
 // QueryFilter in a QueryFilterSet
+// Match is used instead of Func on resources already loaded, by default the value is compared to the field named as the param
 type QueryFilter struct {
 	UrlParam     string
 	Func         QueryFilterFunc
 	Args         interface{}
 	DefaultValue string
+	Match        QueryFilterMatchFunc
 }
 
 // Returns the queryfilter of url param
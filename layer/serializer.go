@@ -4,14 +4,23 @@
 
 package layer
 
+const (
+	// Tag of the serializer groups of a field (ex: `groups:"one,admin"`), the field is never serialized with "-"
+	SERIALIZE_GROUPS_TAG = "groups"
+	// Tag of the name of a field in the serialized resource, its json name by default
+	SERIALIZED_NAME_TAG = "serialized_name"
+)
+
 // Interface to implement in a resource to support serialization
 type SerializeAware interface {
 	Serialize(sc *SerializeGroups) interface{}
 }
 
 // Use a SerializeGroups to handle the display or not of some resource information based on different context values
+// Fields is the sparse fieldset, the paths of the serialized fields (ex: id, bank.name), all the fields are serialized if empty
 type SerializeGroups struct {
 	Values []string
+	Fields []string
 }
 
 // Returns true if the SerializeGroups contains a value
@@ -0,0 +1,154 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/schema"
+)
+
+const (
+	META_PATH = "/_meta"
+)
+
+// Description of a registered resource
+type ResourceMeta struct {
+	Name            string              `json:"name"`
+	Path            string              `json:"path"`
+	Resource        string              `json:"resource"`
+	DAO             string              `json:"dao"`
+	IDParam         string              `json:"idParam"`
+	IDPattern       string              `json:"idPattern,omitempty"`
+	Operations      []string            `json:"operations"`
+	Routes          []ResourceRoute     `json:"routes"`
+	Filters         []FilterMeta        `json:"filters"`
+	Pagination      *PaginationMeta     `json:"pagination,omitempty"`
+	Bindings        []BindingMeta       `json:"bindings"`
+	SerializeGroups map[string][]string `json:"serializeGroups"`
+	Middlewares     map[string][]string `json:"middlewares"`
+	Upsert          bool                `json:"upsert"`
+	UpdateNoContent bool                `json:"updateNoContent"`
+	ValidateSchema  bool                `json:"validateSchema"`
+}
+
+// Description of a filter of a resource
+type FilterMeta struct {
+	Param        string `json:"param"`
+	DefaultValue string `json:"default,omitempty"`
+	Custom       bool   `json:"custom"`
+}
+
+// Description of the pagination of a resource
+type PaginationMeta struct {
+	Param     string `json:"param"`
+	NbPerPage int    `json:"nbPerPage"`
+}
+
+// Description of a uuid binding of a resource
+type BindingMeta struct {
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+}
+
+// Register the route listing the registered resources, it is opt-in and the handlers are run before (ex: a security middleware)
+func Meta(r gin.IRoutes, handlers ...gin.HandlerFunc) {
+	handlers = append(handlers, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"resources": GenerateMeta(),
+		})
+	})
+	r.GET(META_PATH, handlers...)
+}
+
+// Returns the description of the registered resources
+func GenerateMeta() []ResourceMeta {
+	metas := []ResourceMeta{}
+	for _, rr := range GetRegisteredResources() {
+		metas = append(metas, newResourceMeta(rr))
+	}
+	return metas
+}
+
+func newResourceMeta(rr *RegisteredResource) ResourceMeta {
+	m := ResourceMeta{
+		Name:            rr.Options.Name,
+		Path:            rr.Path,
+		Resource:        schema.TypeName(rr.Resource),
+		DAO:             getDAOTypeName(rr.Resource),
+		IDParam:         rr.Options.GetIDParam(),
+		IDPattern:       rr.Options.IDPattern,
+		Operations:      []string{},
+		Routes:          rr.Routes,
+		Filters:         []FilterMeta{},
+		Bindings:        []BindingMeta{},
+		SerializeGroups: map[string][]string{},
+		Middlewares:     map[string][]string{},
+		Upsert:          rr.Options.Upsert,
+		UpdateNoContent: rr.Options.UpdateNoContent,
+		ValidateSchema:  rr.Options.ValidateSchema,
+	}
+	for _, route := range rr.Routes {
+		m.Operations = append(m.Operations, route.Operation)
+		m.SerializeGroups[route.Operation] = rr.Options.GetSerializeGroups(route.Operation).Values
+		m.Middlewares[route.Operation] = []string{}
+		for _, h := range rr.Options.Middlewares[route.Operation] {
+			m.Middlewares[route.Operation] = append(m.Middlewares[route.Operation], getFuncName(h))
+		}
+	}
+
+	if iqfa, ok := rr.Resource.(layer.QueryFilterAware); ok {
+		for _, f := range iqfa.GetQueryFilterSet() {
+			m.Filters = append(m.Filters, FilterMeta{
+				Param:        f.UrlParam,
+				DefaultValue: f.DefaultValue,
+				Custom:       f.Func != nil,
+			})
+		}
+	}
+	if ipa, ok := rr.Resource.(layer.PaginationAware); ok {
+		pc := ipa.GetPaginationConfig()
+		m.Pagination = &PaginationMeta{
+			Param:     pc.QueryParamName,
+			NbPerPage: pc.NbPerPage,
+		}
+	}
+	if ib, ok := rr.Resource.(layer.UUIDBinderInterface); ok {
+		for _, b := range ib.GetUUIDBindings() {
+			m.Bindings = append(m.Bindings, BindingMeta{
+				Name:     b.Name,
+				Resource: schema.TypeName(b.BindTo),
+			})
+		}
+	}
+	return m
+}
+
+// Returns the type name of the DAO of a resource, empty if there is none
+func getDAOTypeName(i interface{}) string {
+	var d dao.DAOInterface
+	if rdo, ok := i.(dao.GetDAOInterface); ok {
+		d = rdo.GetDAO()
+	} else {
+		d = dao.GetDefaultDAO()
+	}
+	if d == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+// Returns the name of a function without its package path (ex: "middleware.SecurityTokenMiddleware.func1")
+func getFuncName(f interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
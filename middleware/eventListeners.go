@@ -9,15 +9,13 @@ import (
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
 )
 
-// Middleware to add in gin configuration to add event listeners
+// Middleware to add in gin configuration to add event listeners for the lifetime of each request
 func EventListenersMiddleware(els []event.EventListener) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		for _, el := range els {
-			event.RegisterEventListener(el)
+			event.RegisterRequestEventListener(c, el)
 		}
 
 		c.Next()
-
-		go event.ResetEventListeners()
 	}
 }
@@ -18,10 +18,9 @@ func RequestLifetimeMiddleware() gin.HandlerFunc {
 
 		c.Next()
 
-		go func() {
-			event.DispatchEvent(c, event.EVENT_REQUEST_TERMINATE, &event.RequestEvent{
-				Context: c,
-			})
-		}()
+		// use Async listeners to run after the response without blocking the request
+		event.DispatchEvent(c, event.EVENT_REQUEST_TERMINATE, &event.RequestEvent{
+			Context: c,
+		})
 	}
 }
@@ -6,8 +6,6 @@ package middleware
 
 import (
 	"net/http"
-	"os"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi"
@@ -17,15 +15,11 @@ import (
 // It needs TOKEN_COOKIE_NAME env var to know the cookie where it is registered
 func SecurityTokenMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tkn, err := c.Cookie(os.Getenv("TOKEN_COOKIE_NAME"))
-		if err != nil {
-			tkn = c.GetHeader("Authorization")
-			if tkn == "" {
-				easyapi.HttpError(c, http.StatusUnauthorized, "Authorization token is required", nil)
-				c.Abort()
-				return
-			}
-			tkn = strings.Replace(tkn, "Bearer ", "", 1)
+		tkn := easyapi.GetRequestToken(c)
+		if tkn == "" {
+			easyapi.HttpError(c, http.StatusUnauthorized, "Authorization token is required", nil)
+			c.Abort()
+			return
 		}
 
 		tknData, err := easyapi.ParseToken(tkn)
@@ -0,0 +1,180 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/orm"
+)
+
+// Middleware to open a database transaction per request, the orm DAO and orm.GetDB use it during the request
+// It is committed if the handler and the event listeners succeed, rolled back otherwise, the functions given to easyapi.OnCommit run after the commit
+// The response is buffered until the commit, a commit failure gives a 500 response instead of the one of the handler
+// The read requests and the connection upgrades (ex: streams, websockets) have no transaction, it would be held as long as the connection
+func TransactionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !needsTransaction(c.Request) {
+			c.Next()
+			return
+		}
+		tx := orm.DB.Begin()
+		if tx.Error != nil {
+			easyapi.HttpError(c, http.StatusInternalServerError, "Transaction error", nil)
+			c.Abort()
+			return
+		}
+		c.Set(orm.CONTEXT_KEY_TX, tx)
+		easyapi.DeferCommitHooks(c)
+
+		w := newTransactionWriter(c.Writer)
+		c.Writer = w
+		defer func() {
+			if r := recover(); r != nil {
+				c.Writer = w.ResponseWriter
+				tx.Rollback()
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if len(c.Errors) > 0 || w.Status() >= http.StatusBadRequest {
+			tx.Rollback()
+			// a listener error without response (or with a buffered success) must not give a success
+			if !w.passthrough && w.Status() < http.StatusBadRequest {
+				easyapi.HttpError(c, http.StatusInternalServerError, "Transaction rolled back", nil)
+				return
+			}
+			w.flush()
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.Error(err)
+			// a streamed response is already sent
+			if !w.passthrough {
+				easyapi.HttpError(c, http.StatusInternalServerError, "Transaction error", nil)
+				return
+			}
+			w.flush()
+			return
+		}
+		w.flush()
+		easyapi.RunCommitHooks(c)
+	}
+}
+
+// Returns true if a request runs in a transaction, the read requests and the connection upgrades do not
+func needsTransaction(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return r.Header.Get("Upgrade") == ""
+}
+
+// Response writer buffering the response until the transaction is committed
+// A flushed or hijacked response (ex: a stream, a websocket) is written directly from then on
+type transactionWriter struct {
+	gin.ResponseWriter
+	body        bytes.Buffer
+	status      int
+	size        int
+	passthrough bool
+}
+
+// Create a response writer buffering the response of a writer, the status already set is kept (ex: 404 on a missing route)
+func newTransactionWriter(w gin.ResponseWriter) *transactionWriter {
+	return &transactionWriter{
+		ResponseWriter: w,
+		status:         w.Status(),
+		size:           -1,
+	}
+}
+
+func (w *transactionWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 && !w.Written() {
+		w.status = code
+	}
+}
+
+func (w *transactionWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	if !w.Written() {
+		w.size = 0
+	}
+}
+
+func (w *transactionWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	w.WriteHeaderNow()
+	n, err := w.body.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *transactionWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *transactionWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *transactionWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	return w.size
+}
+
+func (w *transactionWriter) Written() bool {
+	if w.passthrough {
+		return w.ResponseWriter.Written()
+	}
+	return w.size != -1
+}
+
+func (w *transactionWriter) Flush() {
+	w.flush()
+	w.ResponseWriter.Flush()
+}
+
+func (w *transactionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.flush()
+	return w.ResponseWriter.Hijack()
+}
+
+// Write the buffered response to the underlying writer, the next writes are not buffered anymore
+func (w *transactionWriter) flush() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.size != -1 {
+		w.ResponseWriter.WriteHeaderNow()
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
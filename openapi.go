@@ -0,0 +1,377 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/schema"
+)
+
+const (
+	OPENAPI_VERSION = "3.1.0"
+
+	openAPISchemaRef = "#/components/schemas/"
+)
+
+var (
+	//go:embed openapi.html
+	openAPIHTML     string
+	openAPITemplate = template.Must(template.New("openapi").Parse(openAPIHTML))
+	pathParamRegexp = regexp.MustCompile(`:([^/]+)`)
+)
+
+// OpenAPI configuration
+type OpenAPIConfig struct {
+	Title       string
+	Version     string
+	Description string
+	Servers     []string
+	// Route of the json document, "/openapi.json" by default
+	SpecPath string
+	// Route of the HTML documentation, it is not served if empty
+	DocsPath string
+}
+
+// OpenAPI document
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Servers    []OpenAPIServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*schema.Schema `json:"schemas"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *schema.Schema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *schema.Schema `json:"schema"`
+}
+
+// Register the routes serving the OpenAPI document of the registered resources and its HTML documentation
+func OpenAPI(r gin.IRoutes, config OpenAPIConfig) {
+	if config.SpecPath == "" {
+		config.SpecPath = "/openapi.json"
+	}
+	r.GET(config.SpecPath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, GenerateOpenAPI(config))
+	})
+
+	if config.DocsPath == "" {
+		return
+	}
+	specURL := config.SpecPath
+	if g, ok := r.(interface{ BasePath() string }); ok {
+		specURL = strings.TrimSuffix(g.BasePath(), "/") + config.SpecPath
+	}
+	r.GET(config.DocsPath, func(c *gin.Context) {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		openAPITemplate.Execute(c.Writer, map[string]string{
+			"Title":   config.Title,
+			"SpecURL": specURL,
+		})
+	})
+}
+
+// Generate the OpenAPI document of the registered resources
+func GenerateOpenAPI(config OpenAPIConfig) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: OPENAPI_VERSION,
+		Info: OpenAPIInfo{
+			Title:       config.Title,
+			Version:     config.Version,
+			Description: config.Description,
+		},
+		Paths: map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{
+			Schemas: map[string]*schema.Schema{
+				"Error":           newOpenAPIErrorSchema(),
+				"ValidationError": schema.GenerateType(reflect.TypeOf(layer.ValidationError{})),
+				"JsonPatch": {
+					Type: "array",
+					Items: &schema.Schema{
+						Type:     "object",
+						Required: []string{"op", "path"},
+						Properties: map[string]*schema.Schema{
+							"op":    {Type: "string", Enum: []interface{}{"add", "remove", "replace", "move", "copy", "test"}},
+							"path":  {Type: "string"},
+							"from":  {Type: "string"},
+							"value": {},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, s := range config.Servers {
+		doc.Servers = append(doc.Servers, OpenAPIServer{URL: s})
+	}
+
+	for _, rr := range GetRegisteredResources() {
+		name := schema.TypeName(rr.Resource)
+		s := schema.GenerateType(reflect.Indirect(reflect.ValueOf(rr.Resource)).Type())
+		doc.Components.Schemas[name] = s
+		for _, route := range rr.Routes {
+			path := pathParamRegexp.ReplaceAllString(route.Path, "{$1}")
+			if _, ok := doc.Paths[path]; !ok {
+				doc.Paths[path] = map[string]*OpenAPIOperation{}
+			}
+			doc.Paths[path][strings.ToLower(route.Method)] = newOpenAPIOperation(rr, route, name)
+		}
+	}
+	return doc
+}
+
+// Create the OpenAPI operation of a route
+func newOpenAPIOperation(rr *RegisteredResource, route ResourceRoute, name string) *OpenAPIOperation {
+	ref := &schema.Schema{Ref: openAPISchemaRef + name}
+	op := &OpenAPIOperation{
+		OperationID: route.Name,
+		Tags:        []string{rr.Options.Name},
+		Responses:   map[string]*OpenAPIResponse{},
+	}
+	if strings.Contains(route.Path, ":") {
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name:     rr.Options.GetIDParam(),
+			In:       "path",
+			Required: true,
+			Schema:   &schema.Schema{Type: "string", Pattern: rr.Options.IDPattern},
+		})
+	}
+
+	switch route.Operation {
+	case OPERATION_CREATE:
+		op.Summary = "Create a " + name
+		op.RequestBody = newOpenAPIRequestBody(ref)
+		op.Responses["201"] = newOpenAPIResponse("Created "+name, ref)
+		op.Responses["400"] = newOpenAPIErrorResponse("Validation errors")
+	case OPERATION_READ:
+		op.Summary = "Get a " + name
+		op.Parameters = append(op.Parameters, newOpenAPISelectionParameters()...)
+		op.Responses["200"] = newOpenAPIResponse(name, ref)
+		op.Responses["404"] = newOpenAPIErrorResponse("Not found")
+	case OPERATION_UPDATE:
+		op.Summary = "Update a " + name
+		op.RequestBody = newOpenAPIRequestBody(ref)
+		op.RequestBody.Content[MIME_MERGE_PATCH] = &OpenAPIMediaType{Schema: ref}
+		op.RequestBody.Content[MIME_JSON_PATCH] = &OpenAPIMediaType{Schema: &schema.Schema{Ref: openAPISchemaRef + "JsonPatch"}}
+		if rr.Options.UpdateNoContent {
+			op.Responses["204"] = &OpenAPIResponse{Description: "Updated"}
+		} else {
+			op.Responses["200"] = newOpenAPIResponse("Updated "+name, ref)
+		}
+		op.Responses["400"] = newOpenAPIErrorResponse("Validation errors")
+		op.Responses["404"] = newOpenAPIErrorResponse("Not found")
+	case OPERATION_REPLACE:
+		op.Summary = "Replace a " + name
+		op.RequestBody = newOpenAPIRequestBody(ref)
+		op.Responses["200"] = newOpenAPIResponse("Replaced "+name, ref)
+		if rr.Options.Upsert {
+			op.Responses["201"] = newOpenAPIResponse("Created "+name, ref)
+		}
+		op.Responses["400"] = newOpenAPIErrorResponse("Validation errors")
+		op.Responses["404"] = newOpenAPIErrorResponse("Not found")
+	case OPERATION_DELETE:
+		op.Summary = "Delete a " + name
+		op.Responses["204"] = &OpenAPIResponse{Description: "Deleted"}
+		op.Responses["404"] = newOpenAPIErrorResponse("Not found")
+	case OPERATION_LIST:
+		op.Summary = "List the " + name + " resources"
+		op.Parameters = append(op.Parameters, newOpenAPIQueryParameters(rr.Resource)...)
+		op.Parameters = append(op.Parameters, newOpenAPISelectionParameters()...)
+		op.Responses["200"] = newOpenAPIResponse("Collection of "+name, newOpenAPICollectionSchema(ref))
+		op.Responses["404"] = newOpenAPIErrorResponse("Invalid filter")
+	case OPERATION_BULK_CREATE:
+		op.Summary = "Create multiple " + name + " resources"
+		op.RequestBody = newOpenAPIRequestBody(&schema.Schema{Type: "array", Items: ref})
+		op.Responses["201"] = newOpenAPIResponse("Created "+name+" resources", newOpenAPICollectionSchema(ref))
+		op.Responses["400"] = newOpenAPIErrorResponse("Validation errors")
+	case OPERATION_BULK_UPDATE:
+		op.Summary = "Update multiple " + name + " resources"
+		op.RequestBody = newOpenAPIRequestBody(&schema.Schema{Type: "array", Items: ref})
+		op.Responses["200"] = newOpenAPIResponse("Updated "+name+" resources", newOpenAPICollectionSchema(ref))
+		op.Responses["400"] = newOpenAPIErrorResponse("Validation errors")
+	case OPERATION_BULK_DELETE:
+		op.Summary = "Delete multiple " + name + " resources"
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name:        "ids",
+			In:          "query",
+			Description: "IDs separated by commas",
+			Required:    true,
+			Schema:      &schema.Schema{Type: "string"},
+		})
+		op.Responses["204"] = &OpenAPIResponse{Description: "Deleted"}
+		op.Responses["404"] = newOpenAPIErrorResponse("Not found")
+	case OPERATION_SCHEMA:
+		op.Summary = "JSON Schema of the " + name + " resources"
+		op.Responses["200"] = &OpenAPIResponse{
+			Description: "JSON Schema of " + name,
+			Content: map[string]*OpenAPIMediaType{
+				MIME_SCHEMA_JSON: {Schema: &schema.Schema{Type: "object"}},
+			},
+		}
+	case OPERATION_STREAM:
+		op.Summary = "Stream the changes of the " + name + " resources"
+		op.Parameters = append(op.Parameters, newOpenAPIQueryParameters(rr.Resource)...)
+		op.Responses["200"] = &OpenAPIResponse{
+			Description: "Server-sent events of the " + name + " resources",
+			Content: map[string]*OpenAPIMediaType{
+				"text/event-stream": {Schema: &schema.Schema{Type: "string"}},
+			},
+		}
+	}
+	return op
+}
+
+// Returns the query parameters of the filters and the pagination of a resource
+func newOpenAPIQueryParameters(i interface{}) []*OpenAPIParameter {
+	var params []*OpenAPIParameter
+	if iqfa, ok := i.(layer.QueryFilterAware); ok {
+		for _, f := range iqfa.GetQueryFilterSet() {
+			s := &schema.Schema{Type: "string"}
+			if f.DefaultValue != "" {
+				s.Default = f.DefaultValue
+			}
+			params = append(params, &OpenAPIParameter{
+				Name:   f.UrlParam,
+				In:     "query",
+				Schema: s,
+			})
+		}
+	}
+	if ipa, ok := i.(layer.PaginationAware); ok {
+		pc := ipa.GetPaginationConfig()
+		min := 1.0
+		params = append(params, &OpenAPIParameter{
+			Name:        pc.QueryParamName,
+			In:          "query",
+			Description: fmt.Sprintf("Page number, %s items per page", strconv.Itoa(pc.NbPerPage)),
+			Schema:      &schema.Schema{Type: "integer", Minimum: &min, Default: 1},
+		})
+	}
+	return params
+}
+
+// Returns the query params of the sparse fieldset and of the expanded relations
+func newOpenAPISelectionParameters() []*OpenAPIParameter {
+	return []*OpenAPIParameter{
+		{
+			Name:        QUERY_PARAM_FIELDS,
+			In:          "query",
+			Description: "Serialized fields separated by commas (ex: id,name,bank.name)",
+			Schema:      &schema.Schema{Type: "string"},
+		},
+		{
+			Name:        QUERY_PARAM_EXPAND,
+			In:          "query",
+			Description: "Relations to load separated by commas (ex: bank,bank.owner)",
+			Schema:      &schema.Schema{Type: "string"},
+		},
+	}
+}
+
+// Returns the schema of a collection of resources
+func newOpenAPICollectionSchema(ref *schema.Schema) *schema.Schema {
+	s := schema.GenerateType(reflect.TypeOf(CollectonItem{}))
+	s.Properties["items"].Items = ref
+	return s
+}
+
+func newOpenAPIRequestBody(s *schema.Schema) *OpenAPIRequestBody {
+	return &OpenAPIRequestBody{
+		Required: true,
+		Content: map[string]*OpenAPIMediaType{
+			"application/json": {Schema: s},
+		},
+	}
+}
+
+func newOpenAPIResponse(description string, s *schema.Schema) *OpenAPIResponse {
+	return &OpenAPIResponse{
+		Description: description,
+		Content: map[string]*OpenAPIMediaType{
+			"application/json": {Schema: s},
+		},
+	}
+}
+
+func newOpenAPIErrorResponse(description string) *OpenAPIResponse {
+	if ErrorConfig.Legacy {
+		return newOpenAPIResponse(description, &schema.Schema{Ref: openAPISchemaRef + "Error"})
+	}
+	return &OpenAPIResponse{
+		Description: description,
+		Content: map[string]*OpenAPIMediaType{
+			MIME_PROBLEM_JSON: {Schema: &schema.Schema{Ref: openAPISchemaRef + "Error"}},
+		},
+	}
+}
+
+// Returns the schema of the errors, in the legacy format or as problem details
+func newOpenAPIErrorSchema() *schema.Schema {
+	if ErrorConfig.Legacy {
+		return &schema.Schema{
+			Type: "object",
+			Properties: map[string]*schema.Schema{
+				"error": schema.GenerateType(reflect.TypeOf(httpError{})),
+			},
+		}
+	}
+	s := schema.GenerateType(reflect.TypeOf(Problem{}))
+	s.Properties["errors"] = &schema.Schema{
+		Type:  "array",
+		Items: &schema.Schema{Ref: openAPISchemaRef + "ValidationError"},
+	}
+	return s
+}
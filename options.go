@@ -0,0 +1,206 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+)
+
+const (
+	// Resource operations
+	OPERATION_CREATE  = "create"
+	OPERATION_READ    = "read"
+	OPERATION_UPDATE  = "update"
+	OPERATION_REPLACE = "replace"
+	OPERATION_DELETE  = "delete"
+	OPERATION_LIST    = "list"
+
+	// Bulk operations, they have no CRUDL letter
+	OPERATION_BULK_CREATE = "bulk_create"
+	OPERATION_BULK_UPDATE = "bulk_update"
+	OPERATION_BULK_DELETE = "bulk_delete"
+
+	// Change feed of the resources, it has no CRUDL letter
+	OPERATION_STREAM = "stream"
+
+	// JSON Schema of the resource, it has no CRUDL letter
+	OPERATION_SCHEMA = "schema"
+
+	defaultIDParam = "id"
+)
+
+// Letters accepted by CRUDL, in the order of registration of the routes
+var operationLetters = []struct {
+	Letter    string
+	Operation string
+}{
+	{"C", OPERATION_CREATE},
+	{"R", OPERATION_READ},
+	{"U", OPERATION_UPDATE},
+	{"P", OPERATION_REPLACE},
+	{"D", OPERATION_DELETE},
+	{"L", OPERATION_LIST},
+}
+
+// Operations enabled when none is configured
+var defaultOperations = []string{OPERATION_CREATE, OPERATION_READ, OPERATION_UPDATE, OPERATION_DELETE, OPERATION_LIST}
+
+// Options of the routes registered for a resource with CRUDLWithOptions
+type ResourceOptions struct {
+	// Operations enabled (OPERATION_* values), the CRUDL operations are enabled if empty
+	Operations []string
+	// Middlewares to run before the handler of an operation
+	Middlewares map[string][]gin.HandlerFunc
+	// Name of the ID param in the route path, "id" by default
+	IDParam string
+	// Regular expression the ID param must match, the request ends in a 404 otherwise
+	IDPattern string
+	// Serializer groups of an operation, "one" or "list" by default
+	SerializeGroups map[string][]string
+	// Name of the resource used to name its routes (ex: "users" gives "users.create"), the path by default
+	Name string
+	// If true, a PUT request on an unknown ID creates the resource
+	Upsert bool
+	// If true, the response of a PATCH request has no content (204) instead of the updated resource
+	UpdateNoContent bool
+	// If true, the request bodies are validated against the JSON Schema of the resource before their binding
+	ValidateSchema bool
+	// Validation groups of an operation, "create" or "update" by default
+	ValidationGroups map[string][]string
+	// Denormalization groups of an operation, "create" or "update" by default
+	DenormalizeGroups map[string][]string
+	// Handling of the fields the request cannot write, DENORMALIZE_MODE_IGNORE by default
+	DenormalizeMode string
+	// Relations the requests can expand with the query param expand (ex: "bank", "bank.owner"), all the UUID bindings if empty
+	Expandable []string
+	// Maximum depth of the paths of the query params fields and expand, DEFAULT_MAX_SELECTION_DEPTH if 0
+	MaxSelectionDepth int
+}
+
+// A route registered for a resource
+type ResourceRoute struct {
+	Name      string `json:"name"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Operation string `json:"operation"`
+}
+
+// Create resource options from a CRUDL letters string (ex: "CRUL"), the CRUDL operations are enabled if empty
+func NewResourceOptions(methods string) ResourceOptions {
+	if methods == "" {
+		methods = "CRUDL"
+	}
+	opts := ResourceOptions{}
+	for _, ol := range operationLetters {
+		if strings.Contains(methods, ol.Letter) {
+			opts.Operations = append(opts.Operations, ol.Operation)
+		}
+	}
+	return opts
+}
+
+// Returns true if the operation is enabled
+func (o *ResourceOptions) HasOperation(operation string) bool {
+	operations := o.Operations
+	if len(operations) == 0 {
+		operations = defaultOperations
+	}
+	for _, op := range operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the ID param in the route path
+func (o *ResourceOptions) GetIDParam() string {
+	if o.IDParam == "" {
+		return defaultIDParam
+	}
+	return o.IDParam
+}
+
+// Returns the name of the route of an operation
+func (o *ResourceOptions) GetRouteName(operation string) string {
+	return o.Name + "." + operation
+}
+
+// Returns the serializer groups of an operation
+func (o *ResourceOptions) GetSerializeGroups(operation string) *layer.SerializeGroups {
+	if groups, ok := o.SerializeGroups[operation]; ok {
+		return &layer.SerializeGroups{
+			Values: groups,
+		}
+	}
+	if operation == OPERATION_LIST || operation == OPERATION_BULK_CREATE || operation == OPERATION_BULK_UPDATE {
+		return &layer.SerializeGroups{
+			Values: []string{SERIALIZER_CONTEXT_KEY_LIST},
+		}
+	}
+	return &layer.SerializeGroups{
+		Values: []string{SERIALIZER_CONTEXT_KEY_ONE},
+	}
+}
+
+// Returns the validation groups of an operation
+func (o *ResourceOptions) GetValidationGroups(operation string) []string {
+	if groups, ok := o.ValidationGroups[operation]; ok {
+		return groups
+	}
+	switch operation {
+	case OPERATION_CREATE, OPERATION_BULK_CREATE:
+		return []string{layer.VALIDATION_GROUP_CREATE}
+	case OPERATION_UPDATE, OPERATION_REPLACE, OPERATION_BULK_UPDATE:
+		return []string{layer.VALIDATION_GROUP_UPDATE}
+	}
+	return nil
+}
+
+// Returns the denormalization groups of an operation
+func (o *ResourceOptions) GetDenormalizeGroups(operation string) []string {
+	if groups, ok := o.DenormalizeGroups[operation]; ok {
+		return groups
+	}
+	switch operation {
+	case OPERATION_CREATE, OPERATION_BULK_CREATE:
+		return []string{layer.DENORMALIZE_GROUP_CREATE}
+	case OPERATION_UPDATE, OPERATION_REPLACE, OPERATION_BULK_UPDATE:
+		return []string{layer.DENORMALIZE_GROUP_UPDATE}
+	}
+	return nil
+}
+
+// Returns the maximum depth of the paths of the query params fields and expand
+func (o *ResourceOptions) GetMaxSelectionDepth() int {
+	if o.MaxSelectionDepth <= 0 {
+		return DEFAULT_MAX_SELECTION_DEPTH
+	}
+	return o.MaxSelectionDepth
+}
+
+// Returns true if a relation can be expanded (ex: "bank.owner")
+func (o *ResourceOptions) IsExpandable(path string) bool {
+	if len(o.Expandable) == 0 {
+		return true
+	}
+	for _, e := range o.Expandable {
+		if strings.EqualFold(e, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the resource options of the current route, or the default ones if the handler is used without CRUDLWithOptions
+func GetResourceOptions(c *gin.Context) *ResourceOptions {
+	if o, ok := c.Get(CONTEXT_KEY_RESOURCE_OPTIONS); ok {
+		return o.(*ResourceOptions)
+	}
+	return &ResourceOptions{}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   []*RegisteredResource
+)
+
+// Resource registered with CRUDL or CRUDLWithOptions
+type RegisteredResource struct {
+	// Full path of the resource, with the base path of the router group
+	Path     string
+	Resource interface{}
+	Options  ResourceOptions
+	Routes   []ResourceRoute
+}
+
+// Returns the resources registered with CRUDL or CRUDLWithOptions, in their order of registration
+func GetRegisteredResources() []*RegisteredResource {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]*RegisteredResource{}, registry...)
+}
+
+// Add a resource to the registry
+func registerResource(r gin.IRoutes, path string, i interface{}, opts ResourceOptions, routes []ResourceRoute) {
+	basePath := ""
+	if g, ok := r.(interface{ BasePath() string }); ok {
+		basePath = strings.TrimSuffix(g.BasePath(), "/")
+	}
+	fullRoutes := make([]ResourceRoute, len(routes))
+	for k, route := range routes {
+		route.Path = basePath + route.Path
+		fullRoutes[k] = route
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, &RegisteredResource{
+		Path:     basePath + path,
+		Resource: i,
+		Options:  opts,
+		Routes:   fullRoutes,
+	})
+}
@@ -24,8 +24,7 @@ type CollectonItem struct {
 func NewCollectionItem(items []interface{}, sc *layer.SerializeGroups) *CollectonItem {
 	collection := make([]interface{}, 0)
 	for _, i := range items {
-		Serialize(i, sc)
-		collection = append(collection, i)
+		collection = append(collection, Serialize(i, sc))
 	}
 	return &CollectonItem{
 		Items: collection,
@@ -0,0 +1,315 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// JSON Schema (draft 2020-12) of the resources, generated from their struct fields and tags
+
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DRAFT_2020_12 = "https://json-schema.org/draft/2020-12/schema"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// JSON Schema of a value
+type Schema struct {
+	Schema           string             `json:"$schema,omitempty"`
+	ID               string             `json:"$id,omitempty"`
+	Ref              string             `json:"$ref,omitempty"`
+	Title            string             `json:"title,omitempty"`
+	Type             interface{}        `json:"type,omitempty"`
+	Format           string             `json:"format,omitempty"`
+	Properties       map[string]*Schema `json:"properties,omitempty"`
+	Required         []string           `json:"required,omitempty"`
+	Items            *Schema            `json:"items,omitempty"`
+	Additional       *Schema            `json:"additionalProperties,omitempty"`
+	Enum             []interface{}      `json:"enum,omitempty"`
+	Const            interface{}        `json:"const,omitempty"`
+	Pattern          string             `json:"pattern,omitempty"`
+	MinLength        *int               `json:"minLength,omitempty"`
+	MaxLength        *int               `json:"maxLength,omitempty"`
+	Minimum          *float64           `json:"minimum,omitempty"`
+	Maximum          *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64           `json:"exclusiveMaximum,omitempty"`
+	MinItems         *int               `json:"minItems,omitempty"`
+	MaxItems         *int               `json:"maxItems,omitempty"`
+	Default          interface{}        `json:"default,omitempty"`
+	Description      string             `json:"description,omitempty"`
+	ReadOnly         bool               `json:"readOnly,omitempty"`
+	WriteOnly        bool               `json:"writeOnly,omitempty"`
+}
+
+// Generate the JSON Schema of a resource (a struct or a pointer to a struct)
+func Generate(resource interface{}) *Schema {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s := GenerateType(t)
+	s.Schema = DRAFT_2020_12
+	return s
+}
+
+// Generate the JSON Schema of a type, nested structs are inlined
+func GenerateType(t reflect.Type) *Schema {
+	return generate(t, map[reflect.Type]bool{})
+}
+
+// Returns a copy of a schema validating a partial document, the properties of the objects are not required
+// The items of the arrays are kept as is, an array is always replaced entirely
+func (s *Schema) Partial() *Schema {
+	p := *s
+	p.Required = nil
+	if s.Properties != nil {
+		p.Properties = make(map[string]*Schema, len(s.Properties))
+		for name, ps := range s.Properties {
+			p.Properties[name] = ps.Partial()
+		}
+	}
+	return &p
+}
+
+// Returns the type name of a resource (ex: "User")
+func TypeName(resource interface{}) string {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func generate(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := generate(t.Elem(), seen)
+		if typ, ok := s.Type.(string); ok {
+			s.Type = []string{typ, "null"}
+		}
+		return s
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8 && t.Implements(textMarshalerType):
+		return &Schema{Type: "string", Format: "uuid"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: generate(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", Additional: generate(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return &Schema{Type: "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		s := &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{},
+		}
+		generateFields(t, s, seen)
+		return s
+	}
+	return &Schema{}
+}
+
+// Add the properties of the fields of a struct, embedded structs are flattened
+func generateFields(t reflect.Type, s *Schema, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty := JSONName(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				generateFields(ft, s, seen)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := generate(f.Type, seen)
+		if applyBindingTag(f.Tag.Get("binding"), fs) && !omitempty {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+// Returns the json name of a field and its omitempty option, the name is empty if not set in the tag
+func JSONName(f reflect.StructField) (string, bool) {
+	parts := strings.Split(f.Tag.Get("json"), ",")
+	omitempty := false
+	for _, p := range parts[1:] {
+		if p == "omitempty" {
+			omitempty = true
+		}
+	}
+	return parts[0], omitempty
+}
+
+// Apply the go-playground validator rules of a binding tag to a schema, returns true if the field is required
+// The rules after a dive apply to the items
+func applyBindingTag(tag string, s *Schema) bool {
+	required := false
+	target := s
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if k := strings.Index(rule, "="); k >= 0 {
+			name, param = rule[:k], rule[k+1:]
+		}
+		switch name {
+		case "required":
+			if target == s {
+				required = true
+			}
+		case "dive":
+			if target.Items != nil {
+				target = target.Items
+			}
+		case "email":
+			target.Format = "email"
+		case "uuid", "uuid3", "uuid4", "uuid5":
+			target.Format = "uuid"
+		case "url", "uri":
+			target.Format = "uri"
+		case "ip", "ipv4":
+			target.Format = "ipv4"
+		case "ipv6":
+			target.Format = "ipv6"
+		case "hostname":
+			target.Format = "hostname"
+		case "datetime":
+			target.Format = "date-time"
+		case "alpha":
+			target.Pattern = "^[a-zA-Z]*$"
+		case "alphanum":
+			target.Pattern = "^[a-zA-Z0-9]*$"
+		case "numeric":
+			target.Pattern = "^[-+]?[0-9]+(?:\\.[0-9]+)?$"
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				target.Enum = append(target.Enum, enumValue(target, v))
+			}
+		case "len":
+			applyBound(target, param, true, true)
+		case "min", "gte":
+			applyBound(target, param, true, false)
+		case "max", "lte":
+			applyBound(target, param, false, true)
+		case "gt":
+			if v, err := strconv.ParseFloat(param, 64); err == nil && isNumber(target) {
+				target.ExclusiveMinimum = &v
+			}
+		case "lt":
+			if v, err := strconv.ParseFloat(param, 64); err == nil && isNumber(target) {
+				target.ExclusiveMaximum = &v
+			}
+		}
+	}
+	return required
+}
+
+// Apply a min and/or max bound, a length for strings and arrays, a value for numbers
+func applyBound(s *Schema, param string, min bool, max bool) {
+	v, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	n := int(v)
+	switch {
+	case isNumber(s):
+		if min {
+			s.Minimum = &v
+		}
+		if max {
+			s.Maximum = &v
+		}
+	case hasType(s, "array"):
+		if min {
+			s.MinItems = &n
+		}
+		if max {
+			s.MaxItems = &n
+		}
+	case hasType(s, "string"):
+		if min {
+			s.MinLength = &n
+		}
+		if max {
+			s.MaxLength = &n
+		}
+	}
+}
+
+// Returns the value of an enum in the type of the schema
+func enumValue(s *Schema, v string) interface{} {
+	if isNumber(s) {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+func isNumber(s *Schema) bool {
+	return hasType(s, "integer") || hasType(s, "number")
+}
+
+// Returns true if the schema has a type, nullable types included
+func hasType(s *Schema, typ string) bool {
+	switch t := s.Type.(type) {
+	case string:
+		return t == typ
+	case []string:
+		for _, v := range t {
+			if v == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	uuidRegexp     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+	patterns       sync.Map
+)
+
+// Error of a value which does not match its schema, Pointer is the JSON pointer (RFC 6901) of the value
+type ValidationError struct {
+	Pointer string
+	Keyword string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pointer, e.Message)
+}
+
+// Validate a JSON document against the schema
+func (s *Schema) ValidateJSON(data []byte) ([]ValidationError, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return s.Validate(doc), nil
+}
+
+// Validate a decoded JSON value (map[string]interface{}, []interface{}, string, float64, bool or nil) against the schema
+func (s *Schema) Validate(doc interface{}) []ValidationError {
+	return s.validate(doc, "", nil)
+}
+
+func (s *Schema) validate(v interface{}, pointer string, errs []ValidationError) []ValidationError {
+	addError := func(keyword string, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{
+			Pointer: pointer,
+			Keyword: keyword,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if s.Type != nil && !matchType(s, v) {
+		addError("type", "Value must be of type %v", s.Type)
+		return errs
+	}
+	if len(s.Enum) > 0 && !matchEnum(s.Enum, v) {
+		addError("enum", "Value must be one of %v", s.Enum)
+	}
+	if s.Const != nil && !equal(s.Const, v) {
+		addError("const", "Value must be %v", s.Const)
+	}
+
+	switch value := v.(type) {
+	case string:
+		length := utf8.RuneCountInString(value)
+		if s.MinLength != nil && length < *s.MinLength {
+			addError("minLength", "Value must have at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			addError("maxLength", "Value must have at most %d characters", *s.MaxLength)
+		}
+		if s.Pattern != "" && !matchPattern(s.Pattern, value) {
+			addError("pattern", "Value must match %s", s.Pattern)
+		}
+		if s.Format != "" && !matchFormat(s.Format, value) {
+			addError("format", "Value must be a valid %s", s.Format)
+		}
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			addError("minimum", "Value must be greater than or equal to %v", *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			addError("maximum", "Value must be less than or equal to %v", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && value <= *s.ExclusiveMinimum {
+			addError("exclusiveMinimum", "Value must be greater than %v", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && value >= *s.ExclusiveMaximum {
+			addError("exclusiveMaximum", "Value must be less than %v", *s.ExclusiveMaximum)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			addError("minItems", "Value must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			addError("maxItems", "Value must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for k, item := range value {
+				errs = s.Items.validate(item, pointer+"/"+strconv.Itoa(k), errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				errs = append(errs, ValidationError{
+					Pointer: pointer + "/" + escapePointer(name),
+					Keyword: "required",
+					Message: "Value is required",
+				})
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			item := value[name]
+			ps, ok := s.Properties[name]
+			if !ok {
+				ps = s.Additional
+			}
+			if ps != nil {
+				errs = ps.validate(item, pointer+"/"+escapePointer(name), errs)
+			}
+		}
+	}
+	return errs
+}
+
+// Returns true if the value matches one of the types of the schema
+func matchType(s *Schema, v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return hasType(s, "null")
+	case bool:
+		return hasType(s, "boolean")
+	case float64:
+		return hasType(s, "number") || (hasType(s, "integer") && value == math.Trunc(value))
+	case string:
+		return hasType(s, "string")
+	case []interface{}:
+		return hasType(s, "array")
+	case map[string]interface{}:
+		return hasType(s, "object")
+	}
+	return false
+}
+
+func matchEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if equal(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare two values by their JSON encoding
+func equal(a interface{}, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// Match a pattern, the compiled regular expressions are cached
+func matchPattern(pattern string, v string) bool {
+	re, ok := patterns.Load(pattern)
+	if !ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return false
+		}
+		re, _ = patterns.LoadOrStore(pattern, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(v)
+}
+
+// Match a format, unknown formats are valid
+func matchFormat(format string, v string) bool {
+	switch format {
+	case "email":
+		a, err := mail.ParseAddress(v)
+		return err == nil && a.Address == v
+	case "uuid":
+		return uuidRegexp.MatchString(v)
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, v)
+		return err == nil
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != ""
+	case "ipv4":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil
+	case "ipv6":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() == nil
+	case "hostname":
+		return len(v) <= 253 && hostnameRegexp.MatchString(v)
+	case "byte":
+		_, err := base64.StdEncoding.DecodeString(v)
+		return err == nil
+	}
+	return true
+}
+
+// Escape a reference token of a JSON pointer
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
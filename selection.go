@@ -0,0 +1,178 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+const (
+	// Query params of the sparse fieldset (ex: ?fields=id,name,bank.name) and of the expanded relations (ex: ?expand=bank,bank.owner)
+	QUERY_PARAM_FIELDS = "fields"
+	QUERY_PARAM_EXPAND = "expand"
+
+	// Maximum depth of the paths of the query params fields and expand if not configured
+	DEFAULT_MAX_SELECTION_DEPTH = 3
+)
+
+// Fields and relations requested by the query params of a request
+// Fields are the paths of the serialized fields, Expand the paths of the relations with the names of their UUID bindings (ex: Bank.Owner)
+type selection struct {
+	Fields []string
+	Expand []string
+}
+
+// Returns true if the request has no fields nor expanded relations
+func (s *selection) IsEmpty() bool {
+	return len(s.Fields) == 0 && len(s.Expand) == 0
+}
+
+// Parse the query params fields and expand of a request for a resource, the http error is written if they are invalid
+// The relations must be UUID bindings of the resources, in the Expandable option if it is set
+func getSelection(c *gin.Context, i interface{}) (*selection, error) {
+	opts := GetResourceOptions(c)
+	maxDepth := opts.GetMaxSelectionDepth()
+	s := &selection{}
+
+	for _, path := range splitQueryParam(c.Query(QUERY_PARAM_FIELDS)) {
+		if strings.Count(path, ".")+1 > maxDepth {
+			return nil, HttpErrorWithCode(c, http.StatusBadRequest, layer.ERROR_CODE_INVALID_FIELDS, fmt.Sprintf("Field %s is deeper than %d", path, maxDepth), nil)
+		}
+		s.Fields = append(s.Fields, path)
+	}
+
+	for _, path := range splitQueryParam(c.Query(QUERY_PARAM_EXPAND)) {
+		if strings.Count(path, ".")+1 > maxDepth {
+			return nil, HttpErrorWithCode(c, http.StatusBadRequest, layer.ERROR_CODE_INVALID_EXPAND, fmt.Sprintf("Relation %s is deeper than %d", path, maxDepth), nil)
+		}
+		if !opts.IsExpandable(path) {
+			return nil, HttpErrorWithCode(c, http.StatusBadRequest, layer.ERROR_CODE_INVALID_EXPAND, fmt.Sprintf("Relation %s cannot be expanded", path), nil)
+		}
+		bindingPath, ok := getBindingPath(i, path)
+		if !ok {
+			return nil, HttpErrorWithCode(c, http.StatusBadRequest, layer.ERROR_CODE_INVALID_EXPAND, fmt.Sprintf("Relation %s not found", path), nil)
+		}
+		s.Expand = append(s.Expand, bindingPath)
+	}
+	return s, nil
+}
+
+// Returns the DAO of a resource loading the selection of a request, if the DAO supports it
+// The first segments of the fields are the loaded fields, the expanded relations are preloaded
+// All the fields are loaded if the fieldset is ignored by the serialization (Serialize method or normalizer)
+func getSelectionDAO(c *gin.Context, i interface{}, s *selection) dao.DAOInterface {
+	d := dao.GetContextDAO(c, i)
+	qd, ok := d.(dao.QueryOptionsAwareDAOInterface)
+	if !ok || s.IsEmpty() {
+		return d
+	}
+
+	options := &dao.QueryOptions{
+		Preload: s.Expand,
+	}
+	if len(s.Fields) > 0 && appliesFieldSet(i) {
+		for _, path := range s.Fields {
+			if f, _, ok := utils.FindStructField(reflect.ValueOf(i), strings.Split(path, ".")[0]); ok {
+				options.Fields = append(options.Fields, f.Name)
+			}
+		}
+		// the expanded relations are loaded even if they are not in the fields
+		for _, path := range s.Expand {
+			options.Fields = append(options.Fields, strings.Split(path, ".")[0])
+		}
+	}
+	return qd.WithQueryOptions(options)
+}
+
+// Load the expanded relations of a resource with the DAOs of the relations, if its DAO has not preloaded them
+// The relations which are not found are left empty
+func expandBindings(c *gin.Context, item interface{}, s *selection) {
+	if _, ok := dao.GetContextDAO(c, item).(dao.QueryOptionsAwareDAOInterface); ok || len(s.Expand) == 0 {
+		return
+	}
+	expandBindingPaths(c, item, s.Expand)
+}
+
+// Load the relations of the paths of a resource recursively
+func expandBindingPaths(c *gin.Context, item interface{}, paths []string) {
+	ib, ok := item.(layer.UUIDBinderInterface)
+	if !ok {
+		return
+	}
+	for _, b := range ib.GetUUIDBindings() {
+		var subPaths []string
+		expanded := false
+		for _, path := range paths {
+			segments := strings.SplitN(path, ".", 2)
+			if segments[0] != b.Name {
+				continue
+			}
+			expanded = true
+			if len(segments) == 2 {
+				subPaths = append(subPaths, segments[1])
+			}
+		}
+		if !expanded || b.UUID == nil {
+			continue
+		}
+		if _, err := dao.GetContextDAO(c, b.BindTo).FindById(b.BindTo, b.UUID.String()); err != nil {
+			continue
+		}
+		expandBindingPaths(c, b.BindTo, subPaths)
+	}
+}
+
+// Returns the path of a relation with the names of the UUID bindings (ex: bank.owner gives Bank.Owner), false if one is not a binding
+func getBindingPath(i interface{}, path string) (string, bool) {
+	var names []string
+	item := newResource(i)
+	for _, segment := range strings.Split(path, ".") {
+		ib, ok := item.(layer.UUIDBinderInterface)
+		if !ok {
+			return "", false
+		}
+		found := false
+		for _, b := range ib.GetUUIDBindings() {
+			if strings.EqualFold(b.Name, segment) {
+				names = append(names, b.Name)
+				item = newResource(b.BindTo)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return strings.Join(names, "."), true
+}
+
+// Create a new resource of the type of a resource, its UUID bindings point to its fields
+func newResource(i interface{}) interface{} {
+	t := reflect.TypeOf(i)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.New(t).Interface()
+}
+
+// Split a query param of comma separated values, the empty values are ignored
+func splitQueryParam(param string) []string {
+	var values []string
+	for _, v := range strings.Split(param, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
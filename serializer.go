@@ -4,17 +4,478 @@
 
 package easyapi
 
-import "gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+)
 
 const (
 	SERIALIZER_CONTEXT_KEY_ONE  = "one"
 	SERIALIZER_CONTEXT_KEY_LIST = "list"
 )
 
+// Custom normalizer of a type, it receives a pointer to the resource and returns the value to marshal in json
+type Normalizer func(i interface{}, sc *layer.SerializeGroups) interface{}
+
+// Field of a serialized resource computed from a pointer to the resource, serialized if one of its groups is enabled or if it has none
+type VirtualField struct {
+	Name   string
+	Groups []string
+	Func   func(i interface{}, sc *layer.SerializeGroups) interface{}
+}
+
+var (
+	// Metadata of the serialized types
+	serializerTypes sync.Map
+
+	serializerMu  sync.RWMutex
+	normalizers   = map[reflect.Type]Normalizer{}
+	virtualFields = map[reflect.Type][]VirtualField{}
+
+	serializeAwareType = reflect.TypeOf((*layer.SerializeAware)(nil)).Elem()
+	jsonMarshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Metadata of a type for the serializer
+// Custom is false if the type and its fields are marshalled as is, without tags, normalizers or virtual fields
+// Marshaler is true if the type is marshalled by itself in json (ex: time.Time)
+type serializerType struct {
+	Fields    []serializerField
+	Custom    bool
+	Marshaler bool
+}
+
+// Field of a struct for the serializer, the fields of the embedded structs are flattened
+type serializerField struct {
+	Index     []int
+	Name      string
+	Groups    []string
+	OmitEmpty bool
+}
+
+// Paths of the serialized fields by name, all the fields of a value are serialized if its set is nil
+type fieldSet map[string]fieldSet
+
+// Serialized resource, its fields keep the order of the struct
+type SerializedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// Register a normalizer for the type of a resource, it replaces the tags of the type
+func RegisterNormalizer(resource interface{}, normalizer Normalizer) {
+	serializerMu.Lock()
+	defer serializerMu.Unlock()
+	normalizers[getSerializerKey(resource)] = normalizer
+	resetSerializerTypes()
+}
+
+// Register a virtual field for the type of a resource, it is serialized after the fields of the struct
+func RegisterVirtualField(resource interface{}, field VirtualField) {
+	serializerMu.Lock()
+	defer serializerMu.Unlock()
+	t := getSerializerKey(resource)
+	virtualFields[t] = append(virtualFields[t], field)
+	resetSerializerTypes()
+}
+
 // Serialize a resource (aware of Interface or not)
+// Without Serialize method or normalizer, the fields are serialized with their json names, or the name of their serialized_name tag
+// A field with a groups tag (ex: `groups:"one,admin"`) is serialized only if one of its groups is enabled, never with `groups:"-"`
+// The nested resources are serialized with the same groups, the types without tags are returned as is
+// With the sparse fieldset of the groups, only the fields of its paths are serialized, it does not apply to Serialize methods and normalizers
 func Serialize(i interface{}, sc *layer.SerializeGroups) interface{} {
 	if is, ok := i.(layer.SerializeAware); ok {
 		return is.Serialize(sc)
 	}
+	var fs fieldSet
+	if sc != nil {
+		fs = newFieldSet(sc.Fields)
+	}
+	return serializeValue(reflect.ValueOf(i), sc, fs)
+}
+
+// Serialize a value with its normalizer, its Serialize method or its metadata, fs is its fieldset
+func serializeValue(v reflect.Value, sc *layer.SerializeGroups, fs fieldSet) interface{} {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		if is, ok := v.Addr().Interface().(layer.SerializeAware); ok {
+			return is.Serialize(sc)
+		}
+	}
+	if is, ok := v.Interface().(layer.SerializeAware); ok {
+		return is.Serialize(sc)
+	}
+	serializerMu.RLock()
+	normalizer, ok := normalizers[getSerializerKey(v.Interface())]
+	serializerMu.RUnlock()
+	if ok {
+		return normalizer(getPointer(v), sc)
+	}
+
+	st := getSerializerType(v.Type())
+	if !st.Custom && (fs == nil || st.Marshaler) {
+		return v.Interface()
+	}
+	i := v.Interface()
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		return serializeStruct(getPointer(v), v, st, sc, fs)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for k := range items {
+			items[k] = serializeValue(v.Index(k), sc, fs)
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), reflect.TypeOf((*interface{})(nil)).Elem()), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := serializeValue(iter.Value(), sc, fs)
+			m.SetMapIndex(iter.Key(), reflect.ValueOf(&value).Elem())
+		}
+		return m.Interface()
+	}
 	return i
 }
+
+// Serialize the fields of a struct and its virtual fields enabled by the groups and in the fieldset
+func serializeStruct(i interface{}, v reflect.Value, st *serializerType, sc *layer.SerializeGroups, fs fieldSet) *SerializedObject {
+	o := NewSerializedObject()
+	for _, f := range st.Fields {
+		sub, ok := fs[f.Name]
+		if (fs != nil && !ok) || !inSerializeGroups(f.Groups, sc) {
+			continue
+		}
+		fv, ok := getFieldByIndex(v, f.Index)
+		if !ok || (f.OmitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		o.Set(f.Name, serializeValue(fv, sc, sub))
+	}
+
+	serializerMu.RLock()
+	fields := virtualFields[v.Type()]
+	serializerMu.RUnlock()
+	for _, vf := range fields {
+		if _, ok := fs[vf.Name]; (fs == nil || ok) && inSerializeGroups(vf.Groups, sc) {
+			o.Set(vf.Name, vf.Func(i, sc))
+		}
+	}
+	return o
+}
+
+// Create the fieldset of paths (ex: id, bank.name), nil if there is no path
+// A path without subfields serializes all the fields of its value (ex: bank and bank.name give all the fields of bank)
+func newFieldSet(paths []string) fieldSet {
+	if len(paths) == 0 {
+		return nil
+	}
+	root := fieldSet{}
+	for _, path := range paths {
+		node := root
+		segments := strings.Split(path, ".")
+		for k, segment := range segments {
+			child, ok := node[segment]
+			if k == len(segments)-1 {
+				node[segment] = nil
+				break
+			}
+			if ok && child == nil {
+				break
+			}
+			if !ok {
+				child = fieldSet{}
+				node[segment] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// Returns the metadata of a type, computed once
+func getSerializerType(t reflect.Type) *serializerType {
+	if st, ok := serializerTypes.Load(t); ok {
+		return st.(*serializerType)
+	}
+	bt := derefType(t)
+	st := &serializerType{
+		Custom:    isCustomSerializerType(t, map[reflect.Type]bool{}),
+		Marshaler: isMarshalerType(bt),
+	}
+	if bt.Kind() == reflect.Struct {
+		st.Fields = collectSerializerFields(bt, nil)
+	}
+	actual, _ := serializerTypes.LoadOrStore(t, st)
+	return actual.(*serializerType)
+}
+
+// Collect the serialized fields of a struct type, the embedded structs without json name are flattened
+func collectSerializerFields(t reflect.Type, index []int) []serializerField {
+	fields := []serializerField{}
+	for k := 0; k < t.NumField(); k++ {
+		f := t.Field(k)
+		fieldIndex := append(append([]int{}, index...), k)
+		jsonTag := strings.Split(f.Tag.Get("json"), ",")
+		if f.Anonymous && jsonTag[0] == "" && derefType(f.Type).Kind() == reflect.Struct {
+			fields = append(fields, collectSerializerFields(derefType(f.Type), fieldIndex)...)
+			continue
+		}
+		if f.PkgPath != "" || jsonTag[0] == "-" {
+			continue
+		}
+
+		sf := serializerField{
+			Index: fieldIndex,
+			Name:  f.Name,
+		}
+		if name := f.Tag.Get(layer.SERIALIZED_NAME_TAG); name != "" {
+			sf.Name = name
+		} else if jsonTag[0] != "" {
+			sf.Name = jsonTag[0]
+		}
+		for _, option := range jsonTag[1:] {
+			sf.OmitEmpty = sf.OmitEmpty || option == "omitempty"
+		}
+		if groups, ok := f.Tag.Lookup(layer.SERIALIZE_GROUPS_TAG); ok {
+			if groups == "-" {
+				continue
+			}
+			sf.Groups = []string{}
+			for _, g := range strings.Split(groups, ",") {
+				if g = strings.TrimSpace(g); g != "" {
+					sf.Groups = append(sf.Groups, g)
+				}
+			}
+		}
+		fields = append(fields, sf)
+	}
+	return fields
+}
+
+// Returns true if a type or the types of its fields have serializer tags, a normalizer, virtual fields or a Serialize method
+// The types marshalled by themselves in json are not browsed, visiting contains the types being checked
+func isCustomSerializerType(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	t = derefType(t)
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+
+	serializerMu.RLock()
+	_, hasNormalizer := normalizers[t]
+	hasVirtualFields := len(virtualFields[t]) > 0
+	serializerMu.RUnlock()
+	if hasNormalizer || hasVirtualFields || t.Implements(serializeAwareType) || reflect.PtrTo(t).Implements(serializeAwareType) {
+		return true
+	}
+	if isMarshalerType(t) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for k := 0; k < t.NumField(); k++ {
+			f := t.Field(k)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			if _, ok := f.Tag.Lookup(layer.SERIALIZE_GROUPS_TAG); ok {
+				return true
+			}
+			if _, ok := f.Tag.Lookup(layer.SERIALIZED_NAME_TAG); ok {
+				return true
+			}
+			if isCustomSerializerType(f.Type, visiting) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return isCustomSerializerType(t.Elem(), visiting)
+	}
+	return false
+}
+
+// Returns true if a type is marshalled by itself in json (ex: time.Time, uuid.UUID)
+func isMarshalerType(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return t.Implements(jsonMarshalerType) || pt.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) || pt.Implements(textMarshalerType)
+}
+
+// Returns true if the groups of a field are empty or if one of them is enabled
+func inSerializeGroups(groups []string, sc *layer.SerializeGroups) bool {
+	if groups == nil {
+		return true
+	}
+	if sc == nil {
+		return false
+	}
+	return containsAny(groups, sc.Values)
+}
+
+// Returns the field of a struct by its index, false if an embedded pointer is nil
+func getFieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for k, i := range index {
+		if k > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// Returns true if a value is omitted by the json option omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return v.IsZero()
+	}
+	return false
+}
+
+// Returns a pointer to a value, to a copy if it is not addressable
+func getPointer(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		return v.Interface()
+	}
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
+
+// Returns the type of a resource without pointers, the key of its normalizer and its virtual fields
+func getSerializerKey(resource interface{}) reflect.Type {
+	return derefType(reflect.TypeOf(resource))
+}
+
+// Returns true if the sparse fieldset of the groups applies to a resource, false if it has a Serialize method or a normalizer
+func appliesFieldSet(resource interface{}) bool {
+	t := getSerializerKey(resource)
+	if t == nil || t.Implements(serializeAwareType) || reflect.PtrTo(t).Implements(serializeAwareType) {
+		return false
+	}
+	serializerMu.RLock()
+	defer serializerMu.RUnlock()
+	_, hasNormalizer := normalizers[t]
+	return !hasNormalizer
+}
+
+// Returns a type without pointers
+func derefType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Clear the metadata of the serialized types, the normalizers and the virtual fields change their custom state
+func resetSerializerTypes() {
+	serializerTypes.Range(func(key, value interface{}) bool {
+		serializerTypes.Delete(key)
+		return true
+	})
+}
+
+// Create an empty serialized object
+func NewSerializedObject() *SerializedObject {
+	return &SerializedObject{
+		values: map[string]interface{}{},
+	}
+}
+
+// Set the value of a key, a new key is added at the end
+func (o *SerializedObject) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Returns the value of a key, false if the object has not the key
+func (o *SerializedObject) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Remove a key
+func (o *SerializedObject) Delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for k, existing := range o.keys {
+		if existing == key {
+			o.keys = append(o.keys[:k], o.keys[k+1:]...)
+			break
+		}
+	}
+}
+
+// Returns the keys in their order
+func (o *SerializedObject) Keys() []string {
+	return o.keys
+}
+
+// Implements json.Marshaler, the keys are written in their order
+func (o *SerializedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for k, key := range o.keys {
+		if k > 0 {
+			b.WriteByte(',')
+		}
+		kb, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(kb)
+		b.WriteByte(':')
+		b.Write(vb)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package easyapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+var (
+	StreamConfig = &streamConfig{
+		// Number of events kept by resource type to resume a stream with Last-Event-ID
+		BufferSize: 100,
+		// Delay between two keep alive comments, none if 0
+		KeepAlive: 15 * time.Second,
+	}
+
+	streamBrokersMu sync.Mutex
+	streamBrokers   = map[reflect.Type]*streamBroker{}
+)
+
+// Actions of the resource events sent in the streams
+var streamActions = map[string]string{
+	event.EVENT_RESOURCE_POST_CREATE: OPERATION_CREATE,
+	event.EVENT_RESOURCE_POST_UPDATE: OPERATION_UPDATE,
+	event.EVENT_RESOURCE_POST_DELETE: OPERATION_DELETE,
+}
+
+// Stream config
+type streamConfig struct {
+	BufferSize int
+	KeepAlive  time.Duration
+}
+
+// Event sent in a stream
+type streamEvent struct {
+	ID       uint64
+	Action   string
+	Resource interface{}
+}
+
+// Broker of the events of a resource type, it keeps the last events in a ring buffer
+type streamBroker struct {
+	mu      sync.RWMutex
+	lastID  uint64
+	buffer  []*streamEvent
+	next    int
+	clients map[chan *streamEvent]bool
+}
+
+// Gin handler for a STREAM request, the changes of the resources are sent as server-sent events
+// The query params are the filters of a LIST request, a stream is resumed from the Last-Event-ID header
+func HandleStream(c *gin.Context, i interface{}) {
+	query := c.Request.URL.Query()
+	if iqfa, ok := i.(layer.QueryFilterAware); ok {
+		for key := range query {
+			if iqfa.GetQueryFilterSet().GetByParam(key) == nil {
+				HttpErrorWithCode(c, http.StatusNotFound, layer.ERROR_CODE_INVALID_FILTER, fmt.Sprintf("Param %s is not a filter", key), nil)
+				return
+			}
+		}
+	}
+
+	lastID, _ := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+	b := getStreamBroker(i)
+	ch, backlog := b.subscribe(lastID)
+	defer b.unsubscribe(ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	sc := GetResourceOptions(c).GetSerializeGroups(OPERATION_STREAM)
+	send := func(e *streamEvent) {
+		if !MatchQueryFilters(e.Resource, query) || !CanRead(c, e.Resource) {
+			return
+		}
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatUint(e.ID, 10),
+			Event: e.Action,
+			Data:  NewItem(e.Resource, sc),
+		})
+		c.Writer.Flush()
+	}
+	for _, e := range backlog {
+		send(e)
+	}
+
+	// no keep alive if its delay is not positive, a nil channel never receives
+	var keepAlive <-chan time.Time
+	if StreamConfig.KeepAlive > 0 {
+		ticker := time.NewTicker(StreamConfig.KeepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			send(e)
+		case <-keepAlive:
+			io.WriteString(c.Writer, ": keepalive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// Returns true if a resource matches the query filters and their default values
+func MatchQueryFilters(resource interface{}, query url.Values) bool {
+	iqfa, ok := resource.(layer.QueryFilterAware)
+	if !ok {
+		return true
+	}
+	for _, f := range iqfa.GetQueryFilterSet() {
+		value := query.Get(f.UrlParam)
+		if value == "" {
+			value = f.DefaultValue
+		}
+		if value == "" {
+			continue
+		}
+		match := f.Match
+		if match == nil {
+			match = matchField
+		}
+		if !match(resource, f.UrlParam, value, f.Args) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the resource can be read in a request, the POST_READ listeners do not return an error
+// The listeners run with a copy of the context, their response is discarded
+func CanRead(c *gin.Context, resource interface{}) bool {
+	cc := c.Copy()
+	cc.Writer = &discardWriter{ResponseWriter: c.Writer, header: http.Header{}}
+	err := event.DispatchEvent(cc, event.EVENT_RESOURCE_POST_READ, &event.ResourceActionEvent{
+		Resource: resource,
+		Action:   event.EVENT_RESOURCE_POST_READ,
+	})
+	return err == nil
+}
+
+// Default match of a filter, the value is compared to the field with the json name (or name) of the param
+// The filter matches if the resource has no such field (ex: ordering filters)
+func matchField(resource interface{}, param string, value string, args interface{}) bool {
+	f, ok := utils.FindField(reflect.ValueOf(resource), param)
+	if !ok {
+		return true
+	}
+	return fmt.Sprint(reflect.Indirect(f).Interface()) == value
+}
+
+// Returns the broker of a resource type, it is created and fed by the resource events at first use
+// The events are published after the commit of the transaction of the request, see OnCommit
+func getStreamBroker(i interface{}) *streamBroker {
+	t := reflect.TypeOf(i)
+	streamBrokersMu.Lock()
+	defer streamBrokersMu.Unlock()
+	if b, ok := streamBrokers[t]; ok {
+		return b
+	}
+
+	b := &streamBroker{
+		buffer:  make([]*streamEvent, StreamConfig.BufferSize),
+		clients: map[chan *streamEvent]bool{},
+	}
+	for eventType, action := range streamActions {
+		action := action
+		event.RegisterEventListener(event.EventListener{
+			Type: eventType,
+			Handler: func(c *gin.Context, e event.EventInterface) error {
+				if rae, ok := e.(*event.ResourceActionEvent); ok && reflect.TypeOf(rae.Resource) == t {
+					resource := utils.DeepCloneInterface(rae.Resource)
+					OnCommit(c, func() {
+						b.publish(action, resource)
+					})
+				}
+				return nil
+			},
+		})
+	}
+	streamBrokers[t] = b
+	return b
+}
+
+// Publish an event to the clients, the slow clients are disconnected to resume later
+func (b *streamBroker) publish(action string, resource interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	e := &streamEvent{
+		ID:       b.lastID,
+		Action:   action,
+		Resource: resource,
+	}
+	if len(b.buffer) > 0 {
+		b.buffer[b.next] = e
+		b.next = (b.next + 1) % len(b.buffer)
+	}
+	for ch := range b.clients {
+		select {
+		case ch <- e:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe a client, returns its channel and the buffered events after lastID
+func (b *streamBroker) subscribe(lastID uint64) (chan *streamEvent, []*streamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var backlog []*streamEvent
+	if lastID > 0 {
+		for k := range b.buffer {
+			e := b.buffer[(b.next+k)%len(b.buffer)]
+			if e != nil && e.ID > lastID {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	ch := make(chan *streamEvent, 16)
+	b.clients[ch] = true
+	return ch, backlog
+}
+
+// Unsubscribe a client
+func (b *streamBroker) unsubscribe(ch chan *streamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// Response writer discarding the response
+type discardWriter struct {
+	gin.ResponseWriter
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(code int) {}
+
+func (w *discardWriter) WriteHeaderNow() {}
+
+func (w *discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *discardWriter) WriteString(s string) (int, error) {
+	return len(s), nil
+}
+
+func (w *discardWriter) Flush() {}
@@ -6,9 +6,11 @@ package easyapi
 
 import (
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
 	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
 )
 
@@ -52,3 +54,12 @@ func ParseToken(tokenString string) (interface{}, error) {
 	}
 	return claims.Info, nil
 }
+
+// Returns the token sent in a request, from the cookie configured in TOKEN_COOKIE_NAME env var or the Authorization header
+func GetRequestToken(c *gin.Context) string {
+	tkn, err := c.Cookie(os.Getenv("TOKEN_COOKIE_NAME"))
+	if err != nil {
+		tkn = strings.Replace(c.GetHeader("Authorization"), "Bearer ", "", 1)
+	}
+	return tkn
+}
@@ -19,3 +19,74 @@ func CloneInterface(i interface{}) interface{} {
 
 	return n.Interface()
 }
+
+// Clone a resource recursively, its pointers, slices and maps are not shared with the clone
+// The unexported fields are copied as is
+func DeepCloneInterface(i interface{}) interface{} {
+	if i == nil {
+		return nil
+	}
+	return deepClone(reflect.ValueOf(i), map[uintptr]reflect.Value{}).Interface()
+}
+
+// Clone a value recursively, visited gives the clones of the pointers already cloned
+func deepClone(v reflect.Value, visited map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		if c, ok := visited[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		visited[v.Pointer()] = c
+		c.Elem().Set(deepClone(v.Elem(), visited))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepClone(v.Elem(), visited))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for k := 0; k < v.NumField(); k++ {
+			if f := c.Field(k); f.CanSet() {
+				f.Set(deepClone(v.Field(k), visited))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for k := 0; k < v.Len(); k++ {
+			c.Index(k).Set(deepClone(v.Index(k), visited))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for k := 0; k < v.Len(); k++ {
+			c.Index(k).Set(deepClone(v.Index(k), visited))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepClone(iter.Value(), visited))
+		}
+		return c
+	default:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		return c
+	}
+}
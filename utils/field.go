@@ -0,0 +1,106 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package utils
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Find a field of a struct by its json name or its name (case insensitive), the embedded structs are browsed
+func FindField(v reflect.Value, name string) (reflect.Value, bool) {
+	_, fv, ok := FindStructField(v, name)
+	return fv, ok
+}
+
+// Find a field of a struct and its description by its json name or its name (case insensitive), the embedded structs are browsed
+// An embedded struct is returned if none of its fields matches its name
+func FindStructField(v reflect.Value, name string) (reflect.StructField, reflect.Value, bool) {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return reflect.StructField{}, reflect.Value{}, false
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		jsonName := GetJSONName(f)
+		if f.Anonymous && jsonName == "" && f.Type.Kind() == reflect.Struct {
+			if sf, fv, ok := FindStructField(v.Field(i), name); ok {
+				return sf, fv, true
+			}
+			if strings.EqualFold(f.Name, name) {
+				return f, v.Field(i), true
+			}
+			continue
+		}
+		if f.PkgPath != "" || jsonName == "-" {
+			continue
+		}
+		if jsonName == name || strings.EqualFold(f.Name, name) {
+			return f, v.Field(i), true
+		}
+	}
+	return reflect.StructField{}, reflect.Value{}, false
+}
+
+// Returns the name of a field in its json tag, empty if it has none
+func GetJSONName(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("json"), ",")[0]
+}
+
+// Returns the JSON path and the value of a field from its path in a struct with the field names (ex: Items[3].Qty gives items[3].qty)
+// The names are the json names of the fields, or their names if they have none, and the embedded structs are flattened
+func GetJSONPath(v reflect.Value, namespace string) (string, reflect.Value, bool) {
+	var path strings.Builder
+	for _, segment := range strings.Split(namespace, ".") {
+		name, keys := segment, []string{}
+		if k := strings.Index(segment, "["); k >= 0 {
+			name, keys = segment[:k], strings.Split(strings.TrimSuffix(segment[k+1:], "]"), "][")
+		}
+
+		f, fv, ok := FindStructField(v, name)
+		if !ok {
+			return "", reflect.Value{}, false
+		}
+		if jsonName := GetJSONName(f); !f.Anonymous || jsonName != "" {
+			if jsonName == "" {
+				jsonName = f.Name
+			}
+			if path.Len() > 0 {
+				path.WriteString(".")
+			}
+			path.WriteString(jsonName)
+		}
+
+		v = fv
+		for _, key := range keys {
+			path.WriteString("[" + key + "]")
+			v = getElement(v, key)
+		}
+	}
+	return path.String(), v, true
+}
+
+// Returns the element of a slice, an array or a map by its key, an invalid value if there is none
+func getElement(v reflect.Value, key string) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < v.Len() {
+			return v.Index(i)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			return v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		}
+	}
+	return reflect.Value{}
+}
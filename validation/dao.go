@@ -0,0 +1,282 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+const (
+	// Number of resources compared at once by the unique_with validator when the DAO can not filter the zero values
+	UNIQUE_BATCH_SIZE = 100
+)
+
+var (
+	DAOValidatorConfig = &daoValidatorConfig{
+		// Json name (or name) of the identifier field of the resources, the current resource is excluded from the unique checks
+		IDField: "id",
+	}
+
+	resourcesMu sync.RWMutex
+	resources   = map[string]interface{}{}
+)
+
+// DAO validator config
+type daoValidatorConfig struct {
+	IDField string
+}
+
+// Register the validators unique, unique_with and exists in the validator of gin, they query the DAO of the resources
+// The resources bound by easyapi are validated with the request as context, the validators use the DAO of the request (ex: with its transaction)
+//
+//	Email  string     `binding:"required,unique"`
+//	Name   string     `binding:"unique_with=BankId"`
+//	BankId *uuid.UUID `binding:"exists"`
+func RegisterDAOValidators() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("the validator engine is not a go-playground validator")
+	}
+	validators := map[string]validator.FuncCtx{
+		"unique":      ValidateUnique,
+		"unique_with": ValidateUniqueWith,
+		"exists":      ValidateExists,
+	}
+	for tag, fn := range validators {
+		// called on nil values, they are valid
+		if err := v.RegisterValidationCtx(tag, fn, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register a resource checked by the validator exists with a param (ex: `binding:"exists=bank"`)
+func RegisterResource(name string, resource interface{}) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	resources[name] = resource
+}
+
+// Validator of a field whose value must be unique among the resources, the zero values are valid
+func ValidateUnique(ctx context.Context, fl validator.FieldLevel) bool {
+	return checkUnique(ctx, fl, nil)
+}
+
+// Validator of a field whose value must be unique with the values of other fields (ex: `unique_with=FirstName LastName`)
+// A nil or zero value of another field matches the nil and zero values of this field
+func ValidateUniqueWith(ctx context.Context, fl validator.FieldLevel) bool {
+	return checkUnique(ctx, fl, strings.Fields(fl.Param()))
+}
+
+// Validator of a field referencing the ID of another resource, the zero values are valid
+// The resource is the one registered with the name given in param, or the one of the uuid binding of the field
+func ValidateExists(ctx context.Context, fl validator.FieldLevel) bool {
+	id, ok := getFieldValue(fl.Field())
+	if !ok {
+		return true
+	}
+
+	var target interface{}
+	if name := fl.Param(); name != "" {
+		resourcesMu.RLock()
+		target = resources[name]
+		resourcesMu.RUnlock()
+	} else {
+		target = getBindingTarget(fl)
+	}
+	if target == nil {
+		return false
+	}
+
+	dest := newResource(reflect.ValueOf(target))
+	_, err := getDAO(ctx, dest).FindById(dest, id)
+	return err == nil
+}
+
+// Check there is no other resource with the value of the field and of the given fields
+// The nil or zero values of the given fields are queried with the DAO if it can filter them, by batch of resources otherwise
+// The errors of the DAO are reported in the gin context, the field is invalid if the context is not a gin context
+func checkUnique(ctx context.Context, fl validator.FieldLevel, with []string) bool {
+	value, ok := getFieldValue(fl.Field())
+	if !ok {
+		return true
+	}
+	top := fl.Top()
+	resource := newResource(top)
+	d := getDAO(ctx, resource)
+
+	params := map[string]string{
+		getColumnName(d, resource, fl.StructFieldName()): value,
+	}
+	var zeroFields []string
+	for _, name := range with {
+		fv := reflect.Indirect(top).FieldByName(name)
+		if !fv.IsValid() {
+			return false
+		}
+		v, ok := getFieldValue(fv)
+		if !ok {
+			zeroFields = append(zeroFields, name)
+			continue
+		}
+		params[getColumnName(d, resource, name)] = v
+	}
+
+	id, _ := getID(top)
+	found, err := findOther(d, resource, id, params, zeroFields)
+	if err != nil {
+		return reportError(ctx, fl, err)
+	}
+	return !found
+}
+
+// Returns true if a resource other than the one with the identifier id matches the params and has nil or zero fields
+func findOther(d dao.DAOInterface, resource interface{}, id string, params map[string]string, zeroFields []string) (bool, error) {
+	pf := &dao.PaginationFilter{Limit: 2}
+	if zd, ok := d.(dao.ZeroFilterAwareDAOInterface); ok && len(zeroFields) > 0 {
+		zero := make([]string, len(zeroFields))
+		for k, name := range zeroFields {
+			zero[k] = getColumnName(d, resource, name)
+		}
+		r, err := zd.FindByZero(resource, params, zero, pf)
+		if err != nil {
+			return false, err
+		}
+		return hasOther(r.All(), id, nil), nil
+	}
+
+	// the zero fields are compared on the resources found
+	if len(zeroFields) > 0 {
+		pf.Limit = UNIQUE_BATCH_SIZE
+	}
+	for {
+		r, err := d.FindBy(resource, params, pf)
+		if err != nil {
+			return false, err
+		}
+		if hasOther(r.All(), id, zeroFields) {
+			return true, nil
+		}
+		if len(r.All()) < pf.Limit {
+			return false, nil
+		}
+		pf.Offset += pf.Limit
+	}
+}
+
+// Returns true if a resource other than the one with the identifier id has nil or zero fields
+func hasOther(resources []interface{}, id string, zeroFields []string) bool {
+	for _, found := range resources {
+		if foundID, _ := getID(reflect.ValueOf(found)); id != "" && foundID == id {
+			continue
+		}
+		if hasZeroFields(reflect.Indirect(reflect.ValueOf(found)), zeroFields) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report the error of a validator in the gin context, the request fails with it
+// Returns the result of the validator, valid if the error is reported since the error replaces the validation errors
+func reportError(ctx context.Context, fl validator.FieldLevel, err error) bool {
+	c, ok := ctx.(*gin.Context)
+	if !ok || c == nil {
+		return false
+	}
+	c.Error(&layer.ValidatorError{
+		Tag:   fl.GetTag(),
+		Field: fl.StructFieldName(),
+		Err:   err,
+	})
+	return true
+}
+
+// Returns true if the fields of a resource are nil or zero values
+func hasZeroFields(v reflect.Value, names []string) bool {
+	for _, name := range names {
+		if _, ok := getFieldValue(v.FieldByName(name)); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the DAO of a resource, the one of the request if the context is a gin context
+func getDAO(ctx context.Context, resource interface{}) dao.DAOInterface {
+	c, _ := ctx.(*gin.Context)
+	return dao.GetContextDAO(c, resource)
+}
+
+// Returns the resource bound to a field by GetUUIDBindings, nil if there is none
+func getBindingTarget(fl validator.FieldLevel) interface{} {
+	ib, ok := fl.Top().Interface().(layer.UUIDBinderInterface)
+	if !ok || !fl.Field().CanAddr() {
+		return nil
+	}
+	addr := fl.Field().Addr().Pointer()
+	for _, b := range ib.GetUUIDBindings() {
+		if b.UUID != nil && reflect.ValueOf(b.UUID).Pointer() == addr {
+			return b.BindTo
+		}
+	}
+	return nil
+}
+
+// Returns the column of a field with the DAO, the field name if the DAO does not know it
+func getColumnName(d dao.DAOInterface, resource interface{}, field string) string {
+	if cd, ok := d.(dao.ColumnNameAwareDAOInterface); ok {
+		return cd.GetColumnName(resource, field)
+	}
+	return field
+}
+
+// Returns the identifier of a resource as a string
+func getID(v reflect.Value) (string, bool) {
+	fv, ok := utils.FindField(v, DAOValidatorConfig.IDField)
+	if !ok {
+		return "", false
+	}
+	return getFieldValue(fv)
+}
+
+// Returns the value of a field as a string, false if it is nil or a zero value
+func getFieldValue(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsZero() {
+		return "", false
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String(), true
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+// Create a new resource of the type of a value, pointers are dereferenced (ex: a **Bank gives a *Bank)
+func newResource(v reflect.Value) interface{} {
+	t := v.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.New(t).Interface()
+}
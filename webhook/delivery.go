@@ -0,0 +1,238 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	HEADER_SIGNATURE = "X-Webhook-Signature"
+	HEADER_EVENT_ID  = "X-Webhook-Id"
+
+	// Event of the delivery of a webhook to a subscription
+	EVENT_WEBHOOK_DELIVERY = "webhook.delivery"
+
+	// Retries of a failed delivery if not configured
+	DEFAULT_MAX_RETRIES = 3
+	DEFAULT_BACKOFF     = time.Second
+)
+
+// Actions of the resource events
+var eventActions = map[string]string{
+	event.EVENT_RESOURCE_POST_CREATE: ACTION_CREATE,
+	event.EVENT_RESOURCE_POST_UPDATE: ACTION_UPDATE,
+	event.EVENT_RESOURCE_POST_DELETE: ACTION_DELETE,
+}
+
+// Webhooks configuration
+// The failed deliveries are retried in the worker pool of the async listeners, see event.ConfigureAsync
+type Config struct {
+	// Number of retries of a failed delivery, 3 by default
+	MaxRetries int
+	// Delay before the first retry, doubled at each retry, 1s by default
+	Backoff time.Duration
+	// HTTP client used for the deliveries, with a 10s timeout by default
+	Client *http.Client
+}
+
+// Body of a webhook
+type Payload struct {
+	ID           string      `json:"id"`
+	Action       string      `json:"action"`
+	ResourceType string      `json:"resourceType"`
+	Data         interface{} `json:"data"`
+	Timestamp    time.Time   `json:"timestamp"`
+}
+
+// Delivery of a webhook to a subscription, Attempt is the number of the running attempt
+type DeliveryEvent struct {
+	Subscription *Subscription
+	Payload      *Payload
+	Body         []byte
+	Attempt      int
+}
+
+// Get parent type of the event
+func (de *DeliveryEvent) GetParentEventType() string {
+	return ""
+}
+
+// Register the async listeners sending the webhooks of the resource events
+func Register(config Config) {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = DEFAULT_MAX_RETRIES
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DEFAULT_BACKOFF
+	}
+	for eventType := range eventActions {
+		event.RegisterEventListener(event.EventListener{
+			Type:  eventType,
+			Async: true,
+			Handler: func(c *gin.Context, e event.EventInterface) error {
+				rae, ok := e.(*event.ResourceActionEvent)
+				if !ok {
+					return nil
+				}
+				return send(c, rae)
+			},
+		})
+	}
+	event.RegisterEventListener(event.EventListener{
+		Type:       EVENT_WEBHOOK_DELIVERY,
+		Async:      true,
+		MaxRetries: config.MaxRetries,
+		Backoff:    config.Backoff,
+		Handler: func(c *gin.Context, e event.EventInterface) error {
+			de, ok := e.(*DeliveryEvent)
+			if !ok {
+				return nil
+			}
+			return config.deliver(de)
+		},
+	})
+}
+
+// Returns the signature of a body, "sha256=" followed by the hex HMAC-SHA256 of the body with the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns true if the signature of a body is valid
+func VerifySignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Dispatch the deliveries of the webhook of a resource event to the matching subscriptions
+func send(c *gin.Context, rae *event.ResourceActionEvent) error {
+	if _, ok := rae.Resource.(*Subscription); ok {
+		return nil
+	}
+	if _, ok := rae.Resource.(*Delivery); ok {
+		return nil
+	}
+
+	resourceType := getResourceTypeName(rae.Resource)
+	action := eventActions[rae.Action]
+	s := &Subscription{}
+	r, err := dao.GetResourceDAO(s).FindByFilter(s, []dao.FilterFunc{applySubscriptionFilter(resourceType, action)}, nil)
+	if err != nil {
+		return err
+	}
+
+	payload := &Payload{
+		Action:       action,
+		ResourceType: resourceType,
+		Data: easyapi.Serialize(rae.Resource, &layer.SerializeGroups{
+			Values: []string{easyapi.SERIALIZER_CONTEXT_KEY_ONE},
+		}),
+		Timestamp: time.Now(),
+	}
+	for _, i := range r.All() {
+		sub := i.(*Subscription)
+		if !sub.Matches(resourceType, action) {
+			continue
+		}
+		p := *payload
+		p.ID = uuid.New().String()
+		body, err := json.Marshal(&p)
+		if err != nil {
+			return err
+		}
+		event.DispatchEvent(c, EVENT_WEBHOOK_DELIVERY, &DeliveryEvent{
+			Subscription: sub,
+			Payload:      &p,
+			Body:         body,
+		})
+	}
+	return nil
+}
+
+// Query filter of the active subscriptions which may listen to an action on a resource type, Matches checks the actions exactly
+// The subscriptions are always stored with the orm DAO, see Subscription.GetDAO
+func applySubscriptionFilter(resourceType string, action string) dao.FilterFunc {
+	return func(s *utils.Context) *utils.Context {
+		s.Get("c").(*gorm.DB).Where("active = ? AND LOWER(resource_type) = LOWER(?) AND actions LIKE ?", true, resourceType, "%"+action+"%")
+		return s
+	}
+}
+
+// Deliver a webhook to a subscription once and log the attempt, an error is returned if it failed to be retried
+func (config Config) deliver(de *DeliveryEvent) error {
+	de.Attempt++
+	d := &Delivery{
+		SubscriptionID: de.Subscription.ID,
+		EventID:        de.Payload.ID,
+		Action:         de.Payload.Action,
+		ResourceType:   de.Payload.ResourceType,
+		Attempt:        de.Attempt,
+	}
+	start := time.Now()
+	d.StatusCode, d.Success, d.Error = config.post(de.Subscription, de.Payload.ID, de.Body)
+	d.Duration = time.Since(start).Milliseconds()
+	// a delivery which succeeded is not sent again if it cannot be logged
+	if _, err := dao.GetResourceDAO(d).Create(d); err != nil {
+		log.Printf("webhook delivery %s log error: %v", d.EventID, err)
+	}
+
+	if !d.Success {
+		return fmt.Errorf("webhook delivery %s to %s failed: %s", d.EventID, de.Subscription.TargetURL, d.Error)
+	}
+	return nil
+}
+
+// Post a webhook, returns the status code, the success and the error message
+func (config Config) post(sub *Subscription, id string, body []byte) (int, bool, string) {
+	req, err := http.NewRequest(http.MethodPost, sub.TargetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HEADER_EVENT_ID, id)
+	req.Header.Set(HEADER_SIGNATURE, Sign(sub.Secret, body))
+
+	res, err := config.Client.Do(req)
+	if err != nil {
+		return 0, false, err.Error()
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, false, fmt.Sprintf("status %d", res.StatusCode)
+	}
+	return res.StatusCode, true, ""
+}
+
+// Returns the type name of a resource (ex: "User")
+func getResourceTypeName(resource interface{}) string {
+	t := reflect.TypeOf(resource)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Outgoing webhooks sent to the subscribed URLs when resources are created, updated or deleted
+// The subscriptions and the deliveries are stored with the orm, whatever the DAO of the other resources
+
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/dao"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/db/orm"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+)
+
+const (
+	ACTION_CREATE = "create"
+	ACTION_UPDATE = "update"
+	ACTION_DELETE = "delete"
+)
+
+// Subscription of a URL to the actions on a type of resource
+type Subscription struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	// Type name of the resource (ex: "User")
+	ResourceType string `gorm:"size:128" json:"resourceType" binding:"required"`
+	// Actions separated by commas (ex: "create,delete")
+	Actions   string    `gorm:"size:255" json:"actions" binding:"required"`
+	TargetURL string    `gorm:"size:2048" json:"targetUrl" binding:"required,url"`
+	Secret    string    `gorm:"size:255" json:"secret,omitempty" binding:"required" groups:"-"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Delivery attempt of a webhook
+type Delivery struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint      `gorm:"index" json:"subscriptionId"`
+	EventID        string    `gorm:"size:36;index" json:"eventId"`
+	Action         string    `gorm:"size:16" json:"action"`
+	ResourceType   string    `gorm:"size:128" json:"resourceType"`
+	Attempt        int       `json:"attempt"`
+	StatusCode     int       `json:"statusCode"`
+	Success        bool      `json:"success"`
+	Error          string    `gorm:"type:text" json:"error,omitempty"`
+	Duration       int64     `json:"duration"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Implements dao.GetDAOInterface, the webhooks are stored with the orm whatever the default DAO (see Migrate)
+func (s *Subscription) GetDAO() dao.DAOInterface {
+	return orm.DAO
+}
+
+// Implements dao.GetDAOInterface
+func (d *Delivery) GetDAO() dao.DAOInterface {
+	return orm.DAO
+}
+
+// Returns true if the subscription is active and listens to the action on the resource type
+func (s *Subscription) Matches(resourceType string, action string) bool {
+	if !s.Active || !strings.EqualFold(s.ResourceType, resourceType) {
+		return false
+	}
+	for _, a := range strings.Split(s.Actions, ",") {
+		if strings.TrimSpace(a) == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Implements layer.QueryFilterAware
+func (d *Delivery) GetQueryFilterSet() layer.QueryFilterSet {
+	return layer.QueryFilterSet{
+		{UrlParam: "subscription_id", Func: orm.ApplyExactFilter},
+		{UrlParam: "event_id", Func: orm.ApplyExactFilter},
+		{UrlParam: "order", Func: orm.ApplyOrderFilter, Args: []string{"id", "created_at"}, DefaultValue: "-id"},
+	}
+}
+
+// Implements layer.PaginationAware
+func (d *Delivery) GetPaginationConfig() layer.PaginationConfig {
+	return layer.NewPaginationConfig()
+}
+
+// Create the tables of the subscriptions and the deliveries
+func Migrate() error {
+	return orm.DB.AutoMigrate(&Subscription{}, &Delivery{})
+}
+
+// Register the routes to manage the subscriptions, and to read their deliveries under path/deliveries
+func RegisterRoutes(r gin.IRoutes, path string, opts easyapi.ResourceOptions) {
+	easyapi.CRUDLWithOptions(r, path, new(Subscription), opts)
+	easyapi.CRUDLWithOptions(r, path+"/deliveries", new(Delivery), easyapi.ResourceOptions{
+		Operations:  []string{easyapi.OPERATION_READ, easyapi.OPERATION_LIST},
+		Middlewares: opts.Middlewares,
+	})
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package ws
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+)
+
+const (
+	// Messages sent by the clients
+	MESSAGE_TYPE_SUBSCRIBE   = "subscribe"
+	MESSAGE_TYPE_UNSUBSCRIBE = "unsubscribe"
+
+	// Messages sent by the hub
+	MESSAGE_TYPE_SUBSCRIBED   = "subscribed"
+	MESSAGE_TYPE_UNSUBSCRIBED = "unsubscribed"
+	MESSAGE_TYPE_EVENT        = "event"
+	MESSAGE_TYPE_ERROR        = "error"
+
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+)
+
+// Message exchanged with the clients
+// A subscription targets a single resource with ResourceID, or a filtered collection with Filters
+type message struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id,omitempty"`
+	Resource   string            `json:"resource,omitempty"`
+	ResourceID string            `json:"resourceId,omitempty"`
+	Filters    map[string]string `json:"filters,omitempty"`
+	Action     string            `json:"action,omitempty"`
+	Data       interface{}       `json:"data,omitempty"`
+	Message    string            `json:"message,omitempty"`
+}
+
+// Subscription of a client
+type subscription struct {
+	ID         string
+	Resource   string
+	ResourceID string
+	Filters    map[string]string
+}
+
+// Client connected to the hub
+type client struct {
+	hub  *Hub
+	ctx  *gin.Context
+	conn *websocket.Conn
+	send chan *message
+
+	mu            sync.RWMutex
+	subscriptions map[string]*subscription
+	closed        bool
+}
+
+func newClient(h *Hub, c *gin.Context, conn *websocket.Conn) *client {
+	return &client{
+		hub:           h,
+		ctx:           c,
+		conn:          conn,
+		send:          make(chan *message, 64),
+		subscriptions: map[string]*subscription{},
+	}
+}
+
+// Read the messages of the client until the connection is closed
+func (cl *client) readPump() {
+	cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		m := &message{}
+		if err := cl.conn.ReadJSON(m); err != nil {
+			return
+		}
+		switch m.Type {
+		case MESSAGE_TYPE_SUBSCRIBE:
+			cl.subscribe(m)
+		case MESSAGE_TYPE_UNSUBSCRIBE:
+			cl.mu.Lock()
+			delete(cl.subscriptions, m.ID)
+			cl.mu.Unlock()
+			cl.push(&message{Type: MESSAGE_TYPE_UNSUBSCRIBED, ID: m.ID})
+		default:
+			cl.push(&message{Type: MESSAGE_TYPE_ERROR, ID: m.ID, Message: fmt.Sprintf("Unknown message type %s", m.Type)})
+		}
+	}
+}
+
+// Write the messages to the client and ping it
+func (cl *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		cl.conn.Close()
+	}()
+	for {
+		select {
+		case m, ok := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				cl.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := cl.conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-ticker.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Add a subscription, its filters must be filters of the resource
+func (cl *client) subscribe(m *message) {
+	if m.ID == "" {
+		cl.push(&message{Type: MESSAGE_TYPE_ERROR, Message: "Subscription id is required"})
+		return
+	}
+	hr, err := cl.hub.getResource(m.Resource)
+	if err != nil {
+		cl.push(&message{Type: MESSAGE_TYPE_ERROR, ID: m.ID, Message: err.Error()})
+		return
+	}
+	for key := range m.Filters {
+		iqfa, ok := hr.Resource.(layer.QueryFilterAware)
+		if !ok || iqfa.GetQueryFilterSet().GetByParam(key) == nil {
+			cl.push(&message{Type: MESSAGE_TYPE_ERROR, ID: m.ID, Message: fmt.Sprintf("Param %s is not a filter", key)})
+			return
+		}
+	}
+
+	cl.mu.Lock()
+	cl.subscriptions[m.ID] = &subscription{
+		ID:         m.ID,
+		Resource:   m.Resource,
+		ResourceID: m.ResourceID,
+		Filters:    m.Filters,
+	}
+	cl.mu.Unlock()
+	cl.push(&message{Type: MESSAGE_TYPE_SUBSCRIBED, ID: m.ID})
+}
+
+// Returns the subscriptions of the client matching a resource
+func (cl *client) matchingSubscriptions(resourceName string, resource interface{}) []*subscription {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	var subs []*subscription
+	for _, s := range cl.subscriptions {
+		if s.matches(resourceName, resource) {
+			subs = append(subs, s)
+		}
+	}
+	return subs
+}
+
+// Queue a message to the client without blocking, a slow client is disconnected
+func (cl *client) push(m *message) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.closed {
+		return
+	}
+	select {
+	case cl.send <- m:
+	default:
+		cl.closed = true
+		close(cl.send)
+	}
+}
+
+// Close the send queue, the write pump closes the connection
+func (cl *client) close() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if !cl.closed {
+		cl.closed = true
+		close(cl.send)
+	}
+}
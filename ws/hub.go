@@ -0,0 +1,188 @@
+// Copyright 2021 Kévin José.  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Websocket hub pushing the changes of the resources to the subscribed clients
+
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/event"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/layer"
+	"gitlab.com/kjose/jgmc/api/internal/easyapi/utils"
+)
+
+// Actions of the resource events pushed to the clients
+var eventActions = map[string]string{
+	event.EVENT_RESOURCE_POST_CREATE: easyapi.OPERATION_CREATE,
+	event.EVENT_RESOURCE_POST_UPDATE: easyapi.OPERATION_UPDATE,
+	event.EVENT_RESOURCE_POST_DELETE: easyapi.OPERATION_DELETE,
+}
+
+// Hub of the websocket clients
+type Hub struct {
+	Upgrader websocket.Upgrader
+	// Query param of the token if it is not in the cookie or the Authorization header (browsers can not set headers)
+	TokenQueryParam string
+
+	mu        sync.RWMutex
+	resources map[string]*hubResource
+	types     map[reflect.Type]*hubResource
+	clients   map[*client]bool
+}
+
+// Resource which can be subscribed
+type hubResource struct {
+	Name     string
+	Resource interface{}
+	Groups   *layer.SerializeGroups
+}
+
+// Create a hub, it is fed by the resource events of the registered resources after the commit of their transaction
+func NewHub() *Hub {
+	h := &Hub{
+		TokenQueryParam: "access_token",
+		resources:       map[string]*hubResource{},
+		types:           map[reflect.Type]*hubResource{},
+		clients:         map[*client]bool{},
+	}
+	for eventType, action := range eventActions {
+		action := action
+		event.RegisterEventListener(event.EventListener{
+			Type: eventType,
+			Handler: func(c *gin.Context, e event.EventInterface) error {
+				if rae, ok := e.(*event.ResourceActionEvent); ok {
+					resource := utils.DeepCloneInterface(rae.Resource)
+					easyapi.OnCommit(c, func() {
+						h.publish(action, resource)
+					})
+				}
+				return nil
+			},
+		})
+	}
+	return h
+}
+
+// Register a resource which can be subscribed with its name, groups are its serializer groups ("one" by default)
+func (h *Hub) Register(name string, resource interface{}, groups ...string) {
+	if len(groups) == 0 {
+		groups = []string{easyapi.SERIALIZER_CONTEXT_KEY_ONE}
+	}
+	hr := &hubResource{
+		Name:     name,
+		Resource: resource,
+		Groups:   &layer.SerializeGroups{Values: groups},
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resources[name] = hr
+	h.types[reflect.TypeOf(resource)] = hr
+}
+
+// Gin handler authenticating the client with its JWT token and upgrading the connection to a websocket
+func (h *Hub) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tkn := easyapi.GetRequestToken(c)
+		if tkn == "" {
+			tkn = c.Query(h.TokenQueryParam)
+		}
+		if tkn == "" {
+			easyapi.HttpError(c, http.StatusUnauthorized, "Authorization token is required", nil)
+			return
+		}
+		tknData, err := easyapi.ParseToken(tkn)
+		if err != nil {
+			easyapi.HttpError(c, http.StatusUnauthorized, "Authorization token is invalid", nil)
+			return
+		}
+		c.Set(easyapi.CONTEXT_KEY_TOKEN, tknData)
+
+		conn, err := h.Upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		cl := newClient(h, c, conn)
+		h.mu.Lock()
+		h.clients[cl] = true
+		h.mu.Unlock()
+
+		go cl.writePump()
+		cl.readPump()
+
+		h.mu.Lock()
+		delete(h.clients, cl)
+		h.mu.Unlock()
+		cl.close()
+	}
+}
+
+// Returns a registered resource by its name
+func (h *Hub) getResource(name string) (*hubResource, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	hr, ok := h.resources[name]
+	if !ok {
+		return nil, fmt.Errorf("resource %s is not registered", name)
+	}
+	return hr, nil
+}
+
+// Push a resource event to the subscribed clients
+func (h *Hub) publish(action string, resource interface{}) {
+	h.mu.RLock()
+	hr, ok := h.types[reflect.TypeOf(resource)]
+	clients := make([]*client, 0, len(h.clients))
+	for cl := range h.clients {
+		clients = append(clients, cl)
+	}
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	var data interface{}
+	for _, cl := range clients {
+		for _, sub := range cl.matchingSubscriptions(hr.Name, resource) {
+			if !easyapi.CanRead(cl.ctx, resource) {
+				break
+			}
+			if data == nil {
+				data = easyapi.NewItem(resource, hr.Groups)
+			}
+			cl.push(&message{
+				Type:     MESSAGE_TYPE_EVENT,
+				ID:       sub.ID,
+				Action:   action,
+				Resource: hr.Name,
+				Data:     data,
+			})
+		}
+	}
+}
+
+// Returns true if the subscription matches a resource
+func (s *subscription) matches(resourceName string, resource interface{}) bool {
+	if s.Resource != resourceName {
+		return false
+	}
+	if s.ResourceID != "" {
+		f, ok := utils.FindField(reflect.ValueOf(resource), "id")
+		return ok && fmt.Sprint(reflect.Indirect(f).Interface()) == s.ResourceID
+	}
+	query := url.Values{}
+	for k, v := range s.Filters {
+		query.Set(k, v)
+	}
+	return easyapi.MatchQueryFilters(resource, query)
+}